@@ -1,26 +1,36 @@
 package app
 
 import (
+	"context"
 	"embed"
 	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
-	"sort"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/gofrs/flock"
 	"github.com/mitchellh/go-homedir"
 	"github.com/n0rad/go-app/version"
 	"github.com/n0rad/go-erlog/data"
 	"github.com/n0rad/go-erlog/errs"
-	"github.com/n0rad/go-erlog/logs"
-	"gopkg.in/yaml.v3"
 )
 
 const pathEmbedded = "embedded"
 const pathLock = "lock"
 const pathVersion = "version"
 const pathConfig = "config.yaml"
+const pathPrepared = "prepared"
+
+const maxDefaultExtractConcurrency = 8
+
+var ErrConfigReadOnly = errs.With("Config is read only")
+
+var ErrHomeLocked = errs.With("Home is locked by another process")
 
 type App struct {
 	Name         string
@@ -29,174 +39,972 @@ type App struct {
 	Embedded     *embed.FS
 	EmbeddedPath string
 
-	//semVersion version.SemVersion
+	// ReadOnlyConfig makes every config write method fail with ErrConfigReadOnly
+	ReadOnlyConfig bool
+
+	// WriteExtractionManifest writes size, mode and sha256 of every extracted file to Home/manifest.json
+	WriteExtractionManifest bool
+
+	// ResumableExtract journals extracted files so an interrupted extraction resumes on next Init
+	ResumableExtract bool
+
+	// ExtractByMtime only rewrites files whose on-disk mtime differs from the embedded .manifest.json,
+	// falling back to full extraction when the embedded FS has no manifest
+	ExtractByMtime bool
+
+	// WriteProvenanceXattr sets user.app.version and user.app.extracted_at extended attributes on each written file.
+	// Skipped, with a single warning, where extended attributes are not supported.
+	// Files hard linked by IncrementalExtract share their inode with the previous tree, so they keep its attributes
+	WriteProvenanceXattr bool
+
+	// IncrementalExtract hard links the files of the previous extraction, of this or the home recorded version,
+	// that are identical to the embedded ones according to its manifest, instead of writing them again.
+	// Ignored with ExtractByMtime and ResumableExtract
+	IncrementalExtract bool
+
+	// CheckInodes makes Init fail before extraction when the filesystem has fewer free inodes than embedded entries
+	CheckInodes bool
+
+	// MaxEmbeddedFileSize makes extraction fail on an embedded file bigger than this size in bytes, ignored when 0
+	MaxEmbeddedFileSize int64
+
+	// ExpectedEmbeddedFileCount makes Init fail when the embedded FS holds another number of files, ignored when 0
+	ExpectedEmbeddedFileCount int
+
+	// VerifyOnExtract fails extraction when an extracted file sha256 differs from the embedded .manifest.json
+	VerifyOnExtract bool
+
+	// RetentionPolicy selects the embedded versions removed by cleanup,
+	// by default all but the RetainedEmbeddedVersions newest ones and the current one
+	RetentionPolicy RetentionPolicy
+
+	// RetainedEmbeddedVersions is how many extracted embedded versions the default retention keeps, 3 when lower than 1
+	RetainedEmbeddedVersions int
+
+	// VersionParser orders versions for cleanup and upgrade checks, semver by default
+	VersionParser version.Parser
+
+	// ExtractProgressWriter receives a line per extracted file, like "extracted a/b.txt (3/10)"
+	ExtractProgressWriter io.Writer `yaml:"-"`
+
+	// OnExtractProgress is called as each embedded file is extracted, with the count done and to extract
+	OnExtractProgress func(done, total int, path string) `yaml:"-"`
+
+	// ExtractConcurrency is how many embedded files are extracted at once, runtime.NumCPU() capped to 8 by default
+	ExtractConcurrency int
+
+	// ExtractPriority are path.Match patterns of embedded files extracted first.
+	// With InitAsync, they are extracted before it returns and the rest is extracted in background
+	ExtractPriority []string
+
+	// VerifyHomeOwnership makes Init fail when Home or its entries are owned by another user, ignored on windows
+	VerifyHomeOwnership bool
+
+	// LogInitTimings logs the duration of each Init phase at debug level
+	LogInitTimings bool
+
+	// PreferRAMExtract extracts embedded to /dev/shm/<name>-<uid>/<version> when available with enough space,
+	// falling back to Home, or when that directory is not private to the user. EmbeddedPath is set to the one used
+	PreferRAMExtract bool
+
+	// VerifyExecArch fails extraction when an extracted ELF, Mach-O or PE binary targets another architecture than runtime.GOARCH
+	VerifyExecArch bool
+
+	// VerifyConfigChecksum makes LoadConfig fail with ErrConfigChecksumMismatch when the config file differs from
+	// the checksum written by SaveConfig. RefreshConfigChecksum accepts a manual edit
+	VerifyConfigChecksum bool
+
+	// ConfigPath is the config file loaded instead of the one in Home, when set
+	ConfigPath string
+
+	// ConfigSearchUpward uses the nearest .<name>.yaml found in the working directory or its parents,
+	// instead of the Home config which is only used when none is found
+	ConfigSearchUpward bool
+
+	// DryRun makes Init only log what it would do, as returned by PlanInit, without changing anything
+	DryRun bool
+
+	// StrictInit makes Init fail on problems that are otherwise only logged as warnings
+	StrictInit bool
+
+	// PrepareOnly extracts and cleans up embedded without recording the version in home,
+	// so the next regular Init still behaves as a first run, reusing the prepared extraction
+	PrepareOnly bool
+
+	// SystemConfigPaths are config files loaded before, and overridden by, the config file. Missing ones are skipped.
+	// Defaults to /etc/<name>/config.yaml on unix, an empty slice disables them
+	SystemConfigPaths []string
+
+	// ConfigFormats are the extensions probed, in order, for the config file in Home: yaml, json and toml by default.
+	// Finding more than one is an error. When none exists, the first one is used
+	ConfigFormats []string
+
+	// ConfigReadRetries is how many times a config file failing to parse is read again after a short delay,
+	// in case it was caught while being written
+	ConfigReadRetries int
+
+	// VersionFileCodec formats the version recorded in Home, a plain string by default.
+	// Plain version files are still read when a codec fails to decode them
+	VersionFileCodec VersionFileCodec
+
+	// RequireMinVersion makes Init fail when Version is lower
+	RequireMinVersion string
+
+	// VerifyReadAfterInit is a file, relative to EmbeddedPath (or Home without Embedded), that Init fails to read
+	// as a last check that the process can actually read what was extracted
+	VerifyReadAfterInit string
+
+	// EnsureDirs are relative directories created under EmbeddedPath (or Home without Embedded) on Init,
+	// since go:embed cannot hold empty directories
+	EnsureDirs []string
+
+	// ExtractRoutes are consulted in order to extract matching embedded files under a Home directory like bin or etc,
+	// instead of their embedded location under EmbeddedPath
+	ExtractRoutes []ExtractRoute
+
+	// SafeReextract registers the process on its embedded directory, and before replacing a directory still used by
+	// other processes waits for them a few seconds, then extracts to a fresh <version>+<pid> directory instead
+	SafeReextract bool
+
+	// EmbeddedPrefix is the embedded directory extracted as the root of the embedded FS, like assets for
+	// //go:embed all:assets. Everything else refers to embedded paths relative to it
+	EmbeddedPrefix string
+
+	// EmbeddedChannel is the top level embedded directory extracted, like stable or beta, its content becoming
+	// EmbeddedPath, under Home/embedded/<version>/<channel>. Changing it extracts the other channel on next Init
+	EmbeddedChannel string
+
+	// ExtractIf maps embedded path prefixes to a predicate, skipping their subtree when it returns false.
+	// A subtree whose predicate became true is extracted on next Init
+	ExtractIf map[string]func() bool `yaml:"-"`
+
+	// EmbeddedLocaleDir is the embedded directory holding one subdirectory per locale, like locales.
+	// With Locales set, only their subdirectories are extracted from it
+	EmbeddedLocaleDir string
+	Locales           []string
+
+	// ReadOnlyExtract removes write bits of extracted files and directories, given back only to replace them under the lock
+	ReadOnlyExtract bool
+
+	// LockTimeout makes Init fail with ErrHomeLocked when the lock is not acquired in time, instead of waiting forever
+	LockTimeout time.Duration
+
+	// ReclaimStaleLock records the lock owner pid in the lock file, and proceeds when the lock is still held
+	// after a while by an owner which is not alive anymore, as seen with locks lingering on network filesystems
+	ReclaimStaleLock bool
+
+	// SharedLockPath is a lock file shared by a suite of apps, held during Init with the home lock.
+	// It is always taken before the home lock and released after it, so apps sharing it cannot deadlock
+	SharedLockPath string
+
+	// HomeResolver resolves the home directory when none is given to Init and Home is empty,
+	// instead of DefaultHomeFolder
+	HomeResolver func() (string, error) `yaml:"-"`
+
+	// AllowedHomeRoots makes Init fail when Home, with symlinks resolved, is not under one of these directories
+	AllowedHomeRoots []string
+
+	// FeatureFlags are read on Init from <NAME>_FEATURE_<FLAG>=true|false environment variables, keyed by lowercase flag.
+	// Flags already set, for example from config, are overridden by the environment
+	FeatureFlags map[string]bool
+
+	// DataHome holds the recorded version and prepared marker, Home when empty
+	DataHome string
+
+	// CacheHome holds the embedded extractions with their journal, manifest and pids, Home when empty.
+	// Home keeps the config and the lock
+	CacheHome string
+
+	// Logger receives what Init and cleanup log, the go-erlog global logger by default
+	Logger Logger `yaml:"-"`
+
+	// Handlers receive the Init lifecycle events, in order
+	Handlers []EventHandler `yaml:"-"`
+
+	embeddedMutex sync.RWMutex
+	embeddedReady chan struct{}
+	embeddedErr   error
+	contentHash   *embeddedContentHash
+	config        any
+	configSources map[string]string
 }
 
-func (app *App) LoadConfig(self any) error {
-	configFullPath := filepath.Join(app.Home, pathConfig)
-	if stat, err := os.Stat(configFullPath); os.IsNotExist(err) {
+// lookups used to resolve the default home folder, replaceable in tests
+var (
+	lookupEnv   = os.LookupEnv
+	userHomeDir = homedir.Dir
+	workingDir  = os.Getwd
+)
+
+// DefaultHomeFolder returns $XDG_CONFIG_HOME/<name> when set, as per the freedesktop spec,
+// otherwise ~/.config/<name>, with fallbacks when the user home cannot be found
+func (app *App) DefaultHomeFolder() string {
+	if configHome, ok := lookupEnv("XDG_CONFIG_HOME"); ok && filepath.IsAbs(configHome) {
+		return filepath.Join(configHome, app.Name)
+	}
+
+	home, err := userHomeDir()
+	if err == nil {
+		return filepath.Join(home, ".config/"+app.Name)
+	}
+	app.logger().Warn(err, nil, "Failed to find home directory")
+
+	if home, ok := lookupEnv("HOME"); ok && home != "" {
+		app.logger().Warn(nil, data.WithField("home", home), "Using $HOME as home directory fallback")
+		return filepath.Join(home, ".config/"+app.Name)
+	}
+	if wd, err := workingDir(); err == nil {
+		app.logger().Warn(nil, data.WithField("wd", wd), "Using working directory as home directory fallback")
+		return filepath.Join(wd, "."+app.Name)
+	}
+	app.logger().Warn(nil, data.WithField("tmp", os.TempDir()), "Using temp directory as home directory fallback, content will not survive reboot")
+	return filepath.Join(os.TempDir(), app.Name, ".config/"+app.Name)
+}
+
+func (app *App) Init(home string, self any) error {
+	return app.InitContext(context.Background(), home, self)
+}
+
+// InitContext is Init giving up waiting for the lock, or stopping extraction, when ctx is done
+func (app *App) InitContext(ctx context.Context, home string, self any) error {
+	if app.DryRun {
+		plan, err := app.PlanInit(home, self)
+		if err != nil {
+			return err
+		}
+		plan.log(app.logger())
 		return nil
-	} else if stat.IsDir() {
-		return errs.WithEF(err, data.WithField("path", configFullPath), "Folder found on config location")
 	}
 
-	bytes, err := os.ReadFile(configFullPath)
+	_, err := app.initWithResult(ctx, home, self)
+	return err
+}
+
+// InitWithResult is Init, also returning what it did
+func (app *App) InitWithResult(home string, self any) (*InitResult, error) {
+	return app.initWithResult(context.Background(), home, self)
+}
+
+func (app *App) initWithResult(ctx context.Context, home string, self any) (*InitResult, error) {
+	state, err := app.initHome(ctx, home, self)
 	if err != nil {
-		return errs.WithEF(err, data.WithField("path", configFullPath), "Failed to read config file")
+		return nil, err
 	}
+	defer state.release(app.logger())
+	if err := app.initEmbedded(state); err != nil {
+		return nil, err
+	}
+	state.result.ExtractionComplete = true
+	state.result.Duration = time.Since(state.start)
+	return &state.result, nil
+}
 
-	if err := yaml.Unmarshal(bytes, self); err != nil {
-		return errs.WithEF(err, data.WithField("content", string(bytes)).WithField("path", configFullPath), "Failed to parse config file")
+// InitAsync runs the cheap part of Init (home, lock, version, config) and the extraction of files matching
+// ExtractPriority inline, the rest of the extraction and cleanup in background, still under the home lock.
+// Once it returns, priority files are ready; the returned channel receives the background result and
+// EmbeddedFile blocks until it is available for other files
+func (app *App) InitAsync(home string, self any) (<-chan error, error) {
+	state, err := app.initHome(context.Background(), home, self)
+	if err != nil {
+		return nil, err
+	}
+	state.async = true
+	released := false
+	defer func() {
+		if !released {
+			state.release(app.logger())
+		}
+	}()
+
+	extraction, err := app.startExtraction(state)
+	if err != nil {
+		return nil, err
+	}
+	if extraction != nil && len(extraction.priority) > 0 {
+		if err := app.extractEmbeddedPass(extraction, extraction.isPriority); err != nil {
+			extraction.close()
+			return nil, errs.WithEF(err, data.WithField("path", app.EmbeddedPath), "Failed to restore priority embedded")
+		}
+		extraction.priorityDone = true
+	}
+
+	ready := make(chan struct{})
+	app.embeddedReady = ready
+	result := make(chan error, 1)
+	released = true
+	go func() {
+		err := func() error {
+			defer state.release(app.logger())
+			return app.completeInit(state, extraction)
+		}()
+		app.embeddedErr = err
+		close(ready)
+		result <- err
+		close(result)
+	}()
+	return result, nil
+}
+
+// EmbeddedFile returns the extracted path of an embedded file, waiting for a background extraction to complete
+func (app *App) EmbeddedFile(name string) (string, error) {
+	if app.embeddedReady != nil && !matchesAny(app.ExtractPriority, filepath.ToSlash(name)) {
+		<-app.embeddedReady
+		if app.embeddedErr != nil {
+			return "", errs.WithE(app.embeddedErr, "Embedded extraction failed")
+		}
+	}
+	if !filepath.IsLocal(name) {
+		return "", errs.WithF(data.WithField("name", name), "Embedded file must be a relative path within embedded")
+	}
+	// held until the stat so a switched embedded tree is not removed in between
+	app.embeddedMutex.RLock()
+	defer app.embeddedMutex.RUnlock()
+	path := filepath.Join(app.EmbeddedPath, name)
+	if _, err := os.Stat(path); err != nil {
+		return "", errs.WithEF(err, data.WithField("path", path), "Embedded file not found")
+	}
+	return path, nil
+}
+
+// EmbeddedFS returns the active extracted embedded tree, following StageAndActivate upgrades
+func (app *App) EmbeddedFS() fs.FS {
+	return os.DirFS(app.activeEmbeddedPath())
+}
+
+func (app *App) activeEmbeddedPath() string {
+	app.embeddedMutex.RLock()
+	defer app.embeddedMutex.RUnlock()
+	return app.EmbeddedPath
+}
+
+// resolveHome returns the home given to Init, or else Home, HomeResolver, or the default home folder
+func (app *App) resolveHome(home string) (string, error) {
+	if home != "" {
+		return home, nil
+	}
+	if app.Home != "" {
+		return app.Home, nil
+	}
+	if app.HomeResolver != nil {
+		resolved, err := app.HomeResolver()
+		if err != nil {
+			return "", errs.WithE(err, "Failed to resolve "+app.Name+" home directory")
+		}
+		if resolved == "" {
+			return "", errs.With("Home resolver returned an empty " + app.Name + " home directory")
+		}
+		return resolved, nil
+	}
+	return app.DefaultHomeFolder(), nil
+}
+
+func (app *App) extractConcurrency() int {
+	if app.ExtractConcurrency > 0 {
+		return app.ExtractConcurrency
+	}
+	return min(runtime.NumCPU(), maxDefaultExtractConcurrency)
+}
+
+func (app *App) dataHome() string {
+	if app.DataHome != "" {
+		return app.DataHome
+	}
+	return app.Home
+}
+
+func (app *App) cacheHome() string {
+	if app.CacheHome != "" {
+		return app.CacheHome
+	}
+	return app.Home
+}
+
+// verifyHomeRoot checks the resolved Home is within AllowedHomeRoots, when set
+func (app *App) verifyHomeRoot() error {
+	if len(app.AllowedHomeRoots) == 0 {
+		return nil
+	}
+	resolved, err := filepath.EvalSymlinks(app.Home)
+	if err != nil {
+		return errs.WithEF(err, data.WithField("path", app.Home), "Failed to resolve home")
+	}
+	for _, root := range app.AllowedHomeRoots {
+		resolvedRoot, err := filepath.EvalSymlinks(root)
+		if err != nil {
+			app.logger().Debug(err, data.WithField("root", root), "Skipping allowed home root that cannot be resolved")
+			continue
+		}
+		if rel, err := filepath.Rel(resolvedRoot, resolved); err == nil && filepath.IsLocal(rel) {
+			return nil
+		}
+	}
+	return errs.WithF(data.WithField("path", app.Home).WithField("resolved", resolved).WithField("roots", app.AllowedHomeRoots), "Home is outside allowed roots")
+}
+
+// initState is what the home part of Init found, for the embedded part
+type initState struct {
+	ctx            context.Context
+	start          time.Time
+	lock           *flock.Flock
+	sharedLock     *flock.Flock
+	homeVersion    string
+	homeVersionErr error
+	result         InitResult
+	// async is set by InitAsync, whose priority files must be in place before the rest is extracted
+	async bool
+}
+
+// lockRetryDelay is how often a lock is tried again while waiting with a cancellable context
+const lockRetryDelay = 50 * time.Millisecond
+
+// lockContext takes a lock, giving up when ctx is done
+func lockContext(ctx context.Context, lock *flock.Flock) error {
+	if ctx.Done() == nil {
+		return lock.Lock()
+	}
+	locked, err := lock.TryLockContext(ctx, lockRetryDelay)
+	if err != nil {
+		return err
+	}
+	if !locked {
+		return errs.WithF(data.WithField("path", lock.Path()), "Lock not acquired")
 	}
 	return nil
 }
 
-func (app *App) DefaultHomeFolder() string {
-	home, err := homedir.Dir()
+// acquireLocks takes the shared lock when set, then the home lock, failing with ErrHomeLocked after LockTimeout
+func (app *App) acquireLocks(state *initState) error {
+	ctx := state.ctx
+	lockCtx := ctx
+	if app.LockTimeout > 0 {
+		var cancel context.CancelFunc
+		lockCtx, cancel = context.WithTimeout(ctx, app.LockTimeout)
+		defer cancel()
+	}
+	if app.SharedLockPath != "" {
+		if err := os.MkdirAll(filepath.Dir(app.SharedLockPath), 0755); err != nil {
+			return errs.WithEF(err, data.WithField("path", app.SharedLockPath), "Failed to create shared lock directory")
+		}
+		state.sharedLock = flock.New(app.SharedLockPath)
+		if err := lockContext(lockCtx, state.sharedLock); err != nil {
+			if ctx.Err() == nil && lockCtx.Err() != nil {
+				return ErrHomeLocked
+			}
+			return errs.WithEF(err, data.WithField("path", app.SharedLockPath), "Failed to get shared lock")
+		}
+	}
+	lock, err := app.lockHome(lockCtx, filepath.Join(app.Home, pathLock))
 	if err != nil {
-		logs.WithE(err).Warn("Failed to find home directory")
-		home = filepath.Join(os.TempDir(), app.Name)
+		if state.sharedLock != nil {
+			state.sharedLock.Unlock()
+		}
+		if ctx.Err() == nil && lockCtx.Err() != nil {
+			return ErrHomeLocked
+		}
+		return errs.WithE(err, "Failed to get home preparation lock")
 	}
-	return filepath.Join(home, ".config/"+app.Name)
+	state.lock = lock
+	return nil
 }
 
-func (app *App) Init(home string, self any) error {
-	// Internal binary app version
-	//if semVersion, err := semver.Parse(app.Version); err != nil {
-	//	return errs.WithEF(err, data.WithField("Version", app.Version), "Failed to parse application Version")
-	//} else {
-	//	app.semVersion = version.SemVersion{Version: semVersion}
-	//}
+// release unlocks the home lock then the shared lock, which also closes their file descriptors
+func (state *initState) release(logger Logger) {
+	if err := state.lock.Unlock(); err != nil {
+		logger.Error(err, data.WithField("path", state.lock.Path()), "Failed to release home lock")
+	}
+	if state.sharedLock != nil {
+		if err := state.sharedLock.Unlock(); err != nil {
+			logger.Error(err, data.WithField("path", state.sharedLock.Path()), "Failed to release shared lock")
+		}
+	}
+}
+
+func (app *App) initHome(ctx context.Context, home string, self any) (_ *initState, err error) {
+	start := time.Now()
+	if app.DryRun {
+		return nil, errs.With("DryRun is only supported by Init and InitContext")
+	}
+
+	// stray whitespace from ldflags or shell interpolation would otherwise mismatch the home version on every run
+	app.Version = strings.TrimSpace(app.Version)
+	if err := app.validateVersion(); err != nil {
+		return nil, err
+	}
+	if err := app.checkMinVersion(); err != nil {
+		return nil, err
+	}
 
 	// prepare home
-	app.Home = home
+	if app.Home, err = app.resolveHome(home); err != nil {
+		return nil, err
+	}
 	if err := os.MkdirAll(app.Home, 0755); err != nil {
-		return errs.WithEF(err, data.WithField("path", app.Home), "Failed to create "+app.Name+" home directory")
+		return nil, errs.WithEF(err, data.WithField("path", app.Home), "Failed to create "+app.Name+" home directory")
+	}
+	for _, dir := range []string{app.DataHome, app.CacheHome} {
+		if dir == "" {
+			continue
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, errs.WithEF(err, data.WithField("path", dir), "Failed to create "+app.Name+" home directory")
+		}
+	}
+	if err := app.verifyHomeRoot(); err != nil {
+		return nil, err
+	}
+	if app.VerifyHomeOwnership {
+		if err := verifyOwnership(app.Home); err != nil {
+			return nil, err
+		}
 	}
 
 	// home version
-	lock := flock.New(filepath.Join(app.Home, pathLock))
-	if err := lock.Lock(); err != nil {
-		return errs.WithE(err, "Failed to get home preparation lock")
+	state := &initState{ctx: ctx, start: start}
+	if err := app.acquireLocks(state); err != nil {
+		return nil, err
 	}
-	defer lock.Unlock()
-	homeVersionBytes, err := os.ReadFile(filepath.Join(app.Home, pathVersion))
-	if err != nil {
-		logs.WithE(err).Warn("Failed to read home version. May be first run")
+	defer func() {
+		if err != nil {
+			state.release(app.logger())
+		}
+	}()
+	state.homeVersion, state.homeVersionErr = app.readHomeVersion()
+	state.result.PreviousVersion = state.homeVersion
+	state.result.FirstRun = os.IsNotExist(state.homeVersionErr)
+	if os.IsNotExist(state.homeVersionErr) {
+		app.logger().Warn(state.homeVersionErr, nil, "Failed to read home version. May be first run")
+	} else if state.homeVersionErr != nil {
+		if err := app.warnOrFail(state.homeVersionErr, "Failed to read home version"); err != nil {
+			return nil, err
+		}
 	}
 
+	app.emit(func(handler EventHandler) {
+		handler.OnHomeReady(app.Home)
+	})
+
 	// config
 	if err := app.LoadConfig(self); err != nil {
-		return err
+		return nil, err
+	}
+	if len(app.Handlers) > 0 {
+		configFullPath, _ := app.configPath()
+		app.emit(func(handler EventHandler) {
+			handler.OnConfigLoaded(configFullPath)
+		})
 	}
+	app.loadFeatureFlags()
 
-	// embedded
 	if app.Embedded != nil {
-		app.EmbeddedPath = filepath.Join(app.Home, pathEmbedded, app.Version)
-		if app.Version == "0.0.0" || string(homeVersionBytes) != app.Version || err != nil {
-			logs.WithField("homeVersion", string(homeVersionBytes)).
-				WithField("currentVersion", app.Version).
-				Info(app.Name + " version changed")
-
-			if err := os.RemoveAll(app.EmbeddedPath); err != nil {
-				logs.WithE(err).Warn("Failed to cleanup current embedded before extract")
-			}
+		app.EmbeddedPath = app.resolveEmbeddedPath()
+	}
+	app.logInitPhase("home", start)
+	return state, nil
+}
 
-			if err := app.extractEmbedded(app.EmbeddedPath); err != nil {
-				return errs.WithEF(err, data.WithField("path", app.EmbeddedPath), "Failed to restore embedded")
-			}
-		}
+func (app *App) initEmbedded(state *initState) error {
+	extraction, err := app.startExtraction(state)
+	if err != nil {
+		return err
+	}
+	return app.completeInit(state, extraction)
+}
 
-		if err := app.cleanupEmbedded(); err != nil {
-			logs.WithE(err).Warn("Problem during embedded cleanup")
+// completeInit runs the remaining extraction if any, then finishes Init
+func (app *App) completeInit(state *initState, extraction *extraction) error {
+	if extraction != nil {
+		defer extraction.close()
+		extractStart := time.Now()
+		err := app.runExtraction(state, extraction)
+		app.emit(func(handler EventHandler) {
+			handler.OnExtractFinish(app.EmbeddedPath, len(extraction.manifest), err)
+		})
+		if err != nil {
+			return err
 		}
+		app.logInitPhase("extraction", extractStart)
 	}
 
-	if string(homeVersionBytes) != app.Version {
-		if err := os.WriteFile(filepath.Join(app.Home, pathVersion), []byte(app.Version), 0644); err != nil {
-			logs.WithE(err).Error("Failed to write current " + app.Name + " version to home")
-		}
+	finishStart := time.Now()
+	if err := app.finishInit(state, extraction); err != nil {
+		return err
 	}
+	app.logInitPhase("finish", finishStart)
 
+	duration := time.Since(state.start)
+	app.logger().Debug(nil, data.WithField("duration", duration).WithField("extracted", extraction != nil),
+		app.Name+" initialized in "+strconv.FormatInt(duration.Milliseconds(), 10)+"ms")
 	return nil
 }
 
-///////////////////
+// runExtraction extracts and commits embedded, falling back from RAM to home
+func (app *App) runExtraction(state *initState, extraction *extraction) error {
+	err := app.extractEmbedded(extraction)
+	if err != nil && state.ctx.Err() != nil {
+		extraction.abort(app.logger())
+		return errs.WithEF(state.ctx.Err(), data.WithField("path", app.EmbeddedPath), "Extraction interrupted")
+	}
+	if err != nil && app.EmbeddedPath != app.homeEmbeddedPath() {
+		app.logger().Warn(err, data.WithField("path", app.EmbeddedPath), "Failed to extract embedded to RAM, falling back to home")
+		extraction.abort(app.logger())
+		err = app.fallbackToHome(extraction)
+	}
+	if err == nil {
+		err = extraction.commit()
+	}
+	if err != nil {
+		extraction.abort(app.logger())
+		return errs.WithEF(err, data.WithField("path", app.EmbeddedPath), "Failed to restore embedded")
+	}
+	return nil
+}
 
-func (app *App) extractEmbedded(target string) error {
-	return fs.WalkDir(app.Embedded, ".", func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
+// fallbackToHome extracts again to home after a RAM extraction failed. Priority files of InitAsync, already
+// used from RAM, are extracted to home first so they stay available while the active path switches
+func (app *App) fallbackToHome(extraction *extraction) error {
+	ramPath := app.EmbeddedPath
+	homePath := app.homeEmbeddedPath()
+	if err := removeTree(homePath); err != nil {
+		app.logger().Warn(err, nil, "Failed to cleanup current embedded before extract")
+	}
+	extraction.restart(homePath)
+	if len(extraction.priority) > 0 {
+		if err := app.extractEmbeddedPass(extraction, extraction.isPriority); err != nil {
 			return err
 		}
+		extraction.priorityDone = true
+	}
 
-		newPath := filepath.Join(target, path)
-		if d.IsDir() {
-			return os.MkdirAll(newPath, 0755)
+	app.embeddedMutex.Lock()
+	app.EmbeddedPath = homePath
+	app.embeddedMutex.Unlock()
+	if err := removeTree(ramPath); err != nil {
+		app.logger().Warn(err, data.WithField("path", ramPath), "Failed to remove RAM embedded")
+	}
+	return app.extractEmbedded(extraction)
+}
+
+func (app *App) logInitPhase(phase string, start time.Time) {
+	if app.LogInitTimings {
+		app.logger().Debug(nil, data.WithField("phase", phase).WithField("duration", time.Since(start)), "Init phase done")
+	}
+}
+
+// extractionReason returns why embedded has to be extracted, or an empty string when the extracted one is used
+func (app *App) extractionReason(homeVersion string, homeVersionErr error) string {
+	if app.Version != "0.0.0" && homeVersion == app.Version && homeVersionErr == nil {
+		if _, err := os.Stat(app.EmbeddedPath); err != nil {
+			app.logger().Info(nil, data.WithField("path", app.EmbeddedPath), "Embedded is missing, extracting again")
+			return "embedded is missing"
+		} else if app.missingConditional() {
+			app.logger().Info(nil, data.WithField("path", app.EmbeddedPath), "Embedded is missing newly enabled conditional files, extracting again")
+			return "embedded is missing newly enabled conditional files"
+		} else if err := app.verifyExtractedManifest(); err != nil {
+			app.logger().Warn(err, data.WithField("path", app.EmbeddedPath), "Extracted embedded does not match its manifest, extracting again")
+			return "extracted embedded does not match its manifest"
 		}
+		return ""
+	}
+	if app.isPrepared() {
+		app.logger().Info(nil, data.WithField("path", app.EmbeddedPath), "Using embedded extracted during prepare")
+		return ""
+	}
+	app.logger().Info(nil, data.WithField("homeVersion", homeVersion).WithField("currentVersion", app.Version), app.Name+" version changed")
+	return "version changed"
+}
 
-		if !d.Type().IsRegular() {
-			return errs.WithF(data.WithField("path", path), "Embedded is invalid, not a regular file")
+// startExtraction prepares the extraction of embedded when needed, returning nil otherwise
+func (app *App) startExtraction(state *initState) (*extraction, error) {
+	if app.Embedded == nil {
+		return nil, nil
+	}
+	if err := app.checkEmbeddedRoots(); err != nil {
+		return nil, err
+	}
+	if app.ExpectedEmbeddedFileCount > 0 {
+		if err := app.checkEmbeddedFileCount(); err != nil {
+			return nil, err
 		}
+	}
+	if app.extractionReason(state.homeVersion, state.homeVersionErr) == "" {
+		return nil, nil
+	}
 
-		r, err := app.Embedded.Open(path)
-		if err != nil {
-			return err
+	if app.CheckInodes {
+		if err := app.checkInodes(); err != nil {
+			return nil, err
 		}
-		defer r.Close()
-		info, err := r.Stat()
+	}
+
+	extraction, err := app.newExtraction(state.ctx, app.EmbeddedPath)
+	if err != nil {
+		return nil, err
+	}
+	extraction.priority = app.ExtractPriority
+	if extraction.localeDir != "" {
+		app.warnMissingLocales()
+	}
+
+	if app.ExtractByMtime || app.VerifyOnExtract {
+		embeddedManifest, err := app.readEmbeddedManifest()
 		if err != nil {
-			return err
+			return nil, err
 		}
-		w, err := os.OpenFile(newPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644|info.Mode()&0755)
+		if app.VerifyOnExtract && embeddedManifest == nil {
+			return nil, errs.With("Cannot verify embedded on extract, embedded has no " + pathEmbeddedManifest)
+		}
+		if app.ExtractByMtime {
+			extraction.mtimes = embeddedManifest
+		}
+		if app.VerifyOnExtract {
+			extraction.verify = embeddedManifest
+		}
+	}
+
+	if app.ResumableExtract {
+		journal, err := openExtractJournal(filepath.Join(app.cacheHome(), pathJournal), app.Version, app.logger())
 		if err != nil {
-			return err
+			return nil, err
 		}
+		extraction.journal = journal
+	}
 
-		if _, err := io.Copy(w, r); err != nil {
-			w.Close()
-			return errs.WithEF(err, data.WithField("path", path), "Failed to extract embedded")
+	if extraction.mtimes != nil {
+		app.logger().Debug(nil, data.WithField("path", app.EmbeddedPath), "Extracting embedded files changed since last extraction")
+	} else if extraction.journal == nil || !extraction.journal.resumed {
+		if app.IncrementalExtract && extraction.journal == nil {
+			extraction.previousRoot, extraction.previous = app.previousExtraction(state.homeVersion)
+			// InitAsync priority files are extracted in place, so the tree cannot be kept to link from
+			if state.async && len(extraction.priority) > 0 && extraction.previousRoot == app.EmbeddedPath {
+				extraction.previousRoot, extraction.previous = "", nil
+			}
 		}
-		return w.Close()
+		if app.SafeReextract {
+			app.avoidUsedEmbedded(extraction)
+		}
+		// a tree files are reused from is only replaced on commit
+		if extraction.previous == nil || extraction.previousRoot != app.EmbeddedPath {
+			if err := removeTree(app.EmbeddedPath); err != nil {
+				if err := app.warnOrFail(err, "Failed to cleanup current embedded before extract"); err != nil {
+					extraction.close()
+					return nil, err
+				}
+			}
+		}
+		// a journal already marks an incomplete tree, otherwise stage it so a crash never leaves a partial one in place.
+		// Priority files of InitAsync are used before the commit, so they are extracted in place
+		if extraction.journal == nil && !(state.async && len(extraction.priority) > 0) {
+			extraction.stage(app.EmbeddedPath)
+			if err := removeTree(extraction.target); err != nil {
+				return nil, errs.WithEF(err, data.WithField("path", extraction.target), "Failed to cleanup staging embedded")
+			}
+		}
+	} else {
+		app.logger().Info(nil, data.WithField("path", app.EmbeddedPath), "Resuming interrupted embedded extraction")
+	}
+
+	if err := makeTreeWritable(app.EmbeddedPath); err != nil {
+		extraction.close()
+		return nil, errs.WithEF(err, data.WithField("path", app.EmbeddedPath), "Failed to make embedded writable for extraction")
+	}
+
+	if app.WriteProvenanceXattr {
+		extraction.provenance = &provenance{version: app.Version, logger: app.logger()}
+	}
+	app.emit(func(handler EventHandler) {
+		handler.OnExtractStart(app.EmbeddedPath)
 	})
+	return extraction, nil
 }
 
-func (app *App) cleanupEmbedded() error {
-	dir, err := os.ReadDir(filepath.Join(app.Home, pathEmbedded))
-	if err != nil {
-		return errs.WithE(err, "Failed to read home folder")
-	}
-	var embeddedVersions []string
-	for _, entry := range dir {
-		embeddedVersions = append(embeddedVersions, entry.Name())
-	}
-
-	// Multiple process could be running in parallel and there is no way to know if we can clean up embedded without monitoring process.
-	// To not do process monitoring, we can assume the app will not be updated more than 2 times without having process completed
-	// So we keep 2 embedded + one being installed
-	if len(embeddedVersions) > 3 {
-		sort.Slice(embeddedVersions, func(i, j int) bool {
-			ai, err := version.Parse(embeddedVersions[i])
-			if err != nil {
-				logs.WithEF(err, data.WithField("embedded", i)).Warn("Failed to read embedded version")
-				return false
+// avoidUsedEmbedded switches the extraction to a fresh directory when the existing one is still used by other processes
+func (app *App) avoidUsedEmbedded(extraction *extraction) {
+	if _, err := os.Stat(app.EmbeddedPath); err != nil {
+		return
+	}
+	if app.waitEmbeddedUnused(filepath.Base(app.EmbeddedPath)) {
+		return
+	}
+	fresh := app.EmbeddedPath + "+" + strconv.Itoa(os.Getpid())
+	app.logger().Warn(nil, data.WithField("path", app.EmbeddedPath).WithField("fresh", fresh), "Extracting to a fresh directory instead of replacing the used one")
+	app.EmbeddedPath = fresh
+	extraction.target = fresh
+}
+
+// finishInit records a completed extraction, cleans up old embedded and writes the home version
+func (app *App) finishInit(state *initState, extraction *extraction) error {
+	if extraction != nil {
+		state.result.Extracted = true
+		state.result.FileCount = len(extraction.manifest)
+		if err := extraction.manifest.Write(filepath.Join(app.EmbeddedPath, PathExtractedManifest)); err != nil {
+			return err
+		}
+		if app.WriteExtractionManifest {
+			if err := extraction.manifest.Write(filepath.Join(app.cacheHome(), pathManifest)); err != nil {
+				return err
 			}
-			aj, err := version.Parse(embeddedVersions[j])
-			if err != nil {
-				logs.WithEF(err, data.WithField("embedded", j)).Warn("Failed to read embedded version")
-				return false
+		}
+		if extraction.journal != nil {
+			if err := extraction.journal.Complete(); err != nil {
+				if err := app.warnOrFail(err, "Failed to remove extraction journal"); err != nil {
+					return err
+				}
 			}
-			return ai.Compare(aj) < 0
+		}
+	}
+
+	if app.Embedded != nil {
+		cleaned, err := app.cleanupEmbedded()
+		state.result.CleanedVersions = cleaned
+		app.emit(func(handler EventHandler) {
+			handler.OnCleanupDone(cleaned, err)
 		})
+		if err != nil {
+			if err := app.warnOrFail(err, "Problem during embedded cleanup"); err != nil {
+				return err
+			}
+		}
 
-		oldestEmbedded := embeddedVersions[0]
-		if oldestEmbedded == app.Version {
-			logs.WithField("embedded", oldestEmbedded).Debug("oldest app embedded version is currently used version, not cleaning it up")
-			return nil
+		if stat, err := os.Stat(app.EmbeddedPath); err != nil || !stat.IsDir() {
+			return errs.WithEF(err, data.WithField("path", app.EmbeddedPath).
+				WithField("version", app.Version).
+				WithField("homeVersion", state.homeVersion), "No extracted embedded for current version after init")
+		}
+	}
+
+	if err := app.ensureDirs(); err != nil {
+		return err
+	}
+	if extraction != nil && app.ReadOnlyExtract {
+		if err := makeTreeReadOnly(app.EmbeddedPath); err != nil {
+			return errs.WithEF(err, data.WithField("path", app.EmbeddedPath), "Failed to make embedded read only")
+		}
+	}
+	if app.VerifyReadAfterInit != "" {
+		if err := app.verifyReadable(); err != nil {
+			return err
+		}
+	}
+
+	if app.SafeReextract && app.Embedded != nil {
+		if err := app.registerPid(filepath.Base(app.EmbeddedPath)); err != nil {
+			if err := app.warnOrFail(err, "Failed to register process on embedded"); err != nil {
+				return err
+			}
+		}
+	}
+
+	if app.PrepareOnly {
+		if err := os.WriteFile(filepath.Join(app.dataHome(), pathPrepared), []byte(app.Version), 0644); err != nil {
+			return errs.WithE(err, "Failed to write prepared version to home")
+		}
+		return nil
+	}
+
+	if state.homeVersion != app.Version {
+		if err := app.writeHomeVersion(); err != nil {
+			if app.StrictInit {
+				return errs.WithE(err, "Failed to write current "+app.Name+" version to home")
+			}
+			app.logger().Error(err, nil, "Failed to write current "+app.Name+" version to home")
+		}
+	}
+	if err := os.Remove(filepath.Join(app.dataHome(), pathPrepared)); err != nil && !os.IsNotExist(err) {
+		app.logger().Warn(err, nil, "Failed to remove prepared marker")
+	}
+
+	return nil
+}
+
+///////////////////
+
+// warnOrFail logs a problem Init can live with, or returns it with StrictInit
+func (app *App) warnOrFail(err error, msg string) error {
+	if app.StrictInit {
+		return errs.WithE(err, msg)
+	}
+	app.logger().Warn(err, nil, msg)
+	return nil
+}
+
+// isPrepared reports whether embedded of the current version was extracted by a PrepareOnly run
+func (app *App) isPrepared() bool {
+	if app.Version == "0.0.0" {
+		return false
+	}
+	prepared, err := os.ReadFile(filepath.Join(app.dataHome(), pathPrepared))
+	if err != nil || string(prepared) != app.Version {
+		return false
+	}
+	_, err = os.Stat(app.EmbeddedPath)
+	return err == nil
+}
+
+func (app *App) ensureDirs() error {
+	root := app.Home
+	if app.Embedded != nil {
+		root = app.EmbeddedPath
+	}
+	for _, dir := range app.EnsureDirs {
+		if !filepath.IsLocal(dir) {
+			return errs.WithF(data.WithField("dir", dir), "Ensured directory must be relative and stay within its root")
 		}
-		toCleanupPath := filepath.Join(app.Home, pathEmbedded, oldestEmbedded)
-		if err := os.RemoveAll(toCleanupPath); err != nil {
-			return errs.WithEF(err, data.WithField("folder", toCleanupPath), "Failed to cleanup old embedded")
+		path := filepath.Join(root, dir)
+		if err := os.MkdirAll(path, 0755); err != nil {
+			return errs.WithEF(err, data.WithField("path", path), "Failed to create ensured directory")
 		}
 	}
 	return nil
 }
+
+// verifyReadable reads the VerifyReadAfterInit sentinel file, as the running user
+func (app *App) verifyReadable() error {
+	if !filepath.IsLocal(app.VerifyReadAfterInit) {
+		return errs.WithF(data.WithField("path", app.VerifyReadAfterInit), "Read verification path must be relative and stay within its root")
+	}
+	root := app.Home
+	if app.Embedded != nil {
+		root = app.EmbeddedPath
+	}
+	path := filepath.Join(root, app.VerifyReadAfterInit)
+	f, err := os.Open(path)
+	if err == nil {
+		_, err = io.Copy(io.Discard, f)
+		f.Close()
+	}
+	if err != nil {
+		return errs.WithEF(err, data.WithField("path", path), "Embedded is extracted but unreadable, check its permissions and ownership")
+	}
+	return nil
+}
+
+func (app *App) versionParser() version.Parser {
+	if app.VersionParser != nil {
+		return app.VersionParser
+	}
+	return version.SemverParser{}
+}
+
+// validateVersion checks the application version is valid for the VersionParser, as versions recorded in home
+// and extracted embedded are compared with it
+func (app *App) validateVersion() error {
+	if err := app.versionParser().Validate(app.Version); err != nil {
+		return errs.WithEF(err, data.WithField("version", app.Version), "Invalid application version")
+	}
+	return nil
+}
+
+func (app *App) checkMinVersion() error {
+	if app.RequireMinVersion == "" {
+		return nil
+	}
+	fields := data.WithField("version", app.Version).WithField("minVersion", app.RequireMinVersion)
+	compare, err := app.versionParser().Compare(app.Version, app.RequireMinVersion)
+	if err != nil {
+		return errs.WithEF(err, fields, "Failed to compare application version with required min version")
+	}
+	if compare < 0 {
+		return errs.WithF(fields, app.Name+" is too old, please upgrade")
+	}
+	return nil
+}
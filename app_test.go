@@ -0,0 +1,634 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofrs/flock"
+	"github.com/n0rad/go-app/version"
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+	"github.com/stretchr/testify/assert"
+)
+
+func withHomeLookups(t *testing.T, env map[string]string, home string, wd string) {
+	previousLookupEnv, previousUserHomeDir, previousWorkingDir := lookupEnv, userHomeDir, workingDir
+	t.Cleanup(func() {
+		lookupEnv, userHomeDir, workingDir = previousLookupEnv, previousUserHomeDir, previousWorkingDir
+	})
+
+	lookupEnv = func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	}
+	userHomeDir = func() (string, error) {
+		if home == "" {
+			return "", errors.New("no home")
+		}
+		return home, nil
+	}
+	workingDir = func() (string, error) {
+		if wd == "" {
+			return "", errors.New("no wd")
+		}
+		return wd, nil
+	}
+}
+
+func TestDefaultHomeFolderFallbacks(t *testing.T) {
+	app := App{Name: "myapp"}
+
+	withHomeLookups(t, nil, "/home/user", "/work")
+	assert.Equal(t, "/home/user/.config/myapp", app.DefaultHomeFolder())
+
+	withHomeLookups(t, map[string]string{"HOME": "/env/home"}, "", "/work")
+	assert.Equal(t, "/env/home/.config/myapp", app.DefaultHomeFolder())
+
+	withHomeLookups(t, nil, "", "/work")
+	assert.Equal(t, "/work/.myapp", app.DefaultHomeFolder())
+
+	withHomeLookups(t, nil, "", "")
+	assert.Equal(t, filepath.Join(os.TempDir(), "myapp", ".config/myapp"), app.DefaultHomeFolder())
+}
+
+func TestDefaultHomeFolderXDGConfigHome(t *testing.T) {
+	app := App{Name: "myapp"}
+
+	withHomeLookups(t, map[string]string{"XDG_CONFIG_HOME": "/xdg"}, "/home/user", "/work")
+	assert.Equal(t, "/xdg/myapp", app.DefaultHomeFolder())
+
+	withHomeLookups(t, map[string]string{"XDG_CONFIG_HOME": "/xdg"}, "", "")
+	assert.Equal(t, "/xdg/myapp", app.DefaultHomeFolder())
+
+	// relative paths are invalid per the spec and ignored
+	withHomeLookups(t, map[string]string{"XDG_CONFIG_HOME": "xdg"}, "/home/user", "/work")
+	assert.Equal(t, "/home/user/.config/myapp", app.DefaultHomeFolder())
+}
+
+type recordingLogger struct {
+	mutex    sync.Mutex
+	messages []string
+}
+
+func (l *recordingLogger) Debug(err error, fields data.Fields, msg string) { l.record(msg) }
+func (l *recordingLogger) Info(err error, fields data.Fields, msg string)  { l.record(msg) }
+func (l *recordingLogger) Warn(err error, fields data.Fields, msg string)  { l.record(msg) }
+func (l *recordingLogger) Error(err error, fields data.Fields, msg string) { l.record(msg) }
+
+func (l *recordingLogger) record(msg string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.messages = append(l.messages, msg)
+}
+
+func TestDefaultHomeFolderLogsToLogger(t *testing.T) {
+	logger := &recordingLogger{}
+	app := App{Name: "myapp", Logger: logger}
+
+	withHomeLookups(t, map[string]string{"HOME": "/env/home"}, "", "/work")
+	assert.Equal(t, "/env/home/.config/myapp", app.DefaultHomeFolder())
+	assert.Equal(t, []string{"Failed to find home directory", "Using $HOME as home directory fallback"}, logger.messages)
+}
+
+func TestLoggerReceivesInitMessages(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("RAM extraction is only supported on linux")
+	}
+	previousRAMRoot := ramRoot
+	t.Cleanup(func() { ramRoot = previousRAMRoot })
+	ramRoot = filepath.Join(t.TempDir(), "missing")
+
+	home := t.TempDir()
+	// a line longer than the scanner buffer makes the journal unreadable
+	assert.NoError(t, os.WriteFile(filepath.Join(home, pathJournal), []byte("version 1.0.0\n"+strings.Repeat("x", 70000)+"\n"), 0644))
+
+	logger := &recordingLogger{}
+	app := newTestApp()
+	app.Logger = logger
+	app.PreferRAMExtract = true
+	app.ResumableExtract = true
+	assert.NoError(t, app.Init(home, &struct{}{}))
+	assert.Contains(t, logger.messages, "No RAM backed directory, extracting to home")
+	assert.Contains(t, logger.messages, "Ignoring unreadable extraction journal")
+	assert.Contains(t, logger.messages, "Failed to read home version. May be first run")
+}
+
+func TestLogInitTimings(t *testing.T) {
+	countMessages := func(logger *recordingLogger, prefix string) int {
+		count := 0
+		for _, message := range logger.messages {
+			if strings.HasPrefix(message, prefix) {
+				count++
+			}
+		}
+		return count
+	}
+
+	logger := &recordingLogger{}
+	app := newTestApp()
+	app.Logger = logger
+	assert.NoError(t, app.Init(t.TempDir(), &struct{}{}))
+	assert.Equal(t, 1, countMessages(logger, "test initialized in "))
+	assert.Zero(t, countMessages(logger, "Init phase done"))
+
+	logger = &recordingLogger{}
+	app = newTestApp()
+	app.Logger = logger
+	app.LogInitTimings = true
+	assert.NoError(t, app.Init(t.TempDir(), &struct{}{}))
+	assert.Equal(t, 1, countMessages(logger, "test initialized in "))
+	assert.Equal(t, 3, countMessages(logger, "Init phase done"))
+}
+
+func TestInitInvalidVersion(t *testing.T) {
+	home := t.TempDir()
+	app := newTestApp()
+	app.Version = "not-a-version"
+	assert.Error(t, app.Init(home, &struct{}{}))
+
+	_, err := os.Stat(filepath.Join(home, pathEmbedded))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestRequireMinVersion(t *testing.T) {
+	home := t.TempDir()
+	app := newTestApp()
+	app.RequireMinVersion = "1.1.0"
+	assert.Error(t, app.Init(home, &struct{}{}))
+	assert.NoFileExists(t, filepath.Join(home, pathVersion))
+
+	app = newTestApp()
+	app.RequireMinVersion = "1.0.0"
+	assert.NoError(t, app.Init(home, &struct{}{}))
+
+	app = newTestApp()
+	app.RequireMinVersion = "not-a-version"
+	assert.Error(t, app.Init(home, &struct{}{}))
+}
+
+func TestInitReleasesLockOnError(t *testing.T) {
+	home := t.TempDir()
+	assert.NoError(t, os.Mkdir(filepath.Join(home, pathConfig), 0755))
+
+	app := newTestApp()
+	app.SystemConfigPaths = []string{}
+	assert.Error(t, app.Init(home, &struct{}{}))
+
+	lock := flock.New(filepath.Join(home, pathLock))
+	locked, err := lock.TryLock()
+	assert.NoError(t, err)
+	assert.True(t, locked)
+	assert.NoError(t, lock.Unlock())
+}
+
+func TestFeatureFlags(t *testing.T) {
+	previousEnviron := environ
+	t.Cleanup(func() { environ = previousEnviron })
+	environ = func() []string {
+		return []string{"MY_APP_FEATURE_FAST=true", "MY_APP_FEATURE_OLD=0", "MY_APP_FEATURE_BAD=maybe", "OTHER_FEATURE_X=true"}
+	}
+
+	app := App{Name: "my-app", FeatureFlags: map[string]bool{"old": true, "config": true}}
+	app.loadFeatureFlags()
+
+	assert.True(t, app.Feature("FAST"))
+	assert.False(t, app.Feature("old"))
+	assert.True(t, app.Feature("config"))
+	assert.False(t, app.Feature("bad"))
+	assert.False(t, app.Feature("x"))
+}
+
+func TestAllowedHomeRoots(t *testing.T) {
+	allowed := t.TempDir()
+	outside := t.TempDir()
+	link := filepath.Join(allowed, "home")
+	assert.NoError(t, os.Symlink(outside, link))
+
+	app := App{Name: "test", Home: filepath.Join(allowed, "real"), AllowedHomeRoots: []string{allowed}}
+	assert.NoError(t, os.Mkdir(app.Home, 0755))
+	assert.NoError(t, app.verifyHomeRoot())
+
+	app.Home = link
+	assert.Error(t, app.verifyHomeRoot())
+}
+
+func TestVerifyHomeOwnership(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("home ownership is not verified on windows")
+	}
+	home := t.TempDir()
+	app := newTestApp()
+	app.VerifyHomeOwnership = true
+	assert.NoError(t, app.Init(home, &struct{}{}))
+
+	if os.Getuid() != 0 {
+		t.Skip("giving a file to another user requires root")
+	}
+	foreign := writeTestFile(t, filepath.Join(home, "foreign"), "")
+	assert.NoError(t, os.Lchown(foreign, os.Getuid()+1, os.Getgid()))
+	app = newTestApp()
+	app.VerifyHomeOwnership = true
+	assert.Error(t, app.Init(home, &struct{}{}))
+}
+
+func TestInitTrimsVersionWhitespace(t *testing.T) {
+	home := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(home, pathVersion), []byte(" 1.2.3\n"), 0644))
+
+	app := App{Name: "test", Version: " 1.2.3\n", SystemConfigPaths: []string{}}
+	assert.NoError(t, app.Init(home, &struct{}{}))
+	assert.Equal(t, "1.2.3", app.Version)
+
+	homeVersion, err := app.readHomeVersion()
+	assert.NoError(t, err)
+	assert.Equal(t, "1.2.3", homeVersion)
+}
+
+func TestVersionFileCodec(t *testing.T) {
+	previousNow := version.Now
+	t.Cleanup(func() { version.Now = previousNow })
+	version.Now = func() time.Time { return time.Date(2024, 3, 1, 12, 0, 0, 0, time.FixedZone("CET", 3600)) }
+
+	home := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(home, pathVersion), []byte("0.9.0\n"), 0644))
+
+	app := App{Name: "test", Home: home, Version: "1.0.0", VersionFileCodec: JSONVersionCodec{}}
+	homeVersion, err := app.readHomeVersion()
+	assert.NoError(t, err)
+	assert.Equal(t, "0.9.0", homeVersion)
+
+	assert.NoError(t, app.writeHomeVersion())
+	content, err := os.ReadFile(filepath.Join(home, pathVersion))
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), `"version":"1.0.0"`)
+	assert.Contains(t, string(content), `"writtenAt":"2024-03-01T11:00:00Z"`)
+	homeVersion, err = app.readHomeVersion()
+	assert.NoError(t, err)
+	assert.Equal(t, "1.0.0", homeVersion)
+}
+
+func TestSharedLockPath(t *testing.T) {
+	sharedLock := filepath.Join(t.TempDir(), "suite", "lock")
+	app := newTestApp()
+	app.SharedLockPath = sharedLock
+	assert.NoError(t, app.Init(t.TempDir(), &struct{}{}))
+
+	lock := flock.New(sharedLock)
+	locked, err := lock.TryLock()
+	assert.NoError(t, err)
+	assert.True(t, locked)
+
+	other := newTestApp()
+	other.SharedLockPath = sharedLock
+	result := make(chan error)
+	go func() { result <- other.Init(t.TempDir(), &struct{}{}) }()
+	select {
+	case <-result:
+		t.Fatal("Init must wait for the shared lock")
+	case <-time.After(100 * time.Millisecond):
+	}
+	assert.NoError(t, lock.Unlock())
+	assert.NoError(t, <-result)
+}
+
+func TestInitContextCancelledWaitingLock(t *testing.T) {
+	home := t.TempDir()
+	lock := flock.New(filepath.Join(home, pathLock))
+	assert.NoError(t, lock.Lock())
+	defer lock.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.Error(t, newTestApp().InitContext(ctx, home, &struct{}{}))
+}
+
+func TestLockTimeout(t *testing.T) {
+	home := t.TempDir()
+	lock := flock.New(filepath.Join(home, pathLock))
+	assert.NoError(t, lock.Lock())
+	defer lock.Unlock()
+
+	app := newTestApp()
+	app.LockTimeout = 100 * time.Millisecond
+	assert.Equal(t, ErrHomeLocked, app.Init(home, &struct{}{}))
+}
+
+func TestReclaimStaleLock(t *testing.T) {
+	previousInterval := staleLockCheckInterval
+	t.Cleanup(func() { staleLockCheckInterval = previousInterval })
+	staleLockCheckInterval = 50 * time.Millisecond
+
+	exited := exec.Command("true")
+	assert.NoError(t, exited.Run())
+
+	home := t.TempDir()
+	lock := flock.New(filepath.Join(home, pathLock))
+	assert.NoError(t, lock.Lock())
+	defer lock.Unlock()
+	assert.NoError(t, os.WriteFile(lock.Path(), []byte(strconv.Itoa(exited.Process.Pid)), 0644))
+
+	logger := &recordingLogger{}
+	app := newTestApp()
+	app.Logger = logger
+	app.ReclaimStaleLock = true
+	app.LockTimeout = 5 * time.Second
+	assert.NoError(t, app.Init(home, &struct{}{}))
+	assert.Contains(t, logger.messages, "Home lock owner is gone, reclaiming stale lock")
+
+	// the stale lock is left to its holder, the reclaimer took and recorded a new one
+	stale, err := lock.Stat()
+	assert.NoError(t, err)
+	current, err := os.Stat(lock.Path())
+	assert.NoError(t, err)
+	assert.False(t, os.SameFile(stale, current))
+	owner, err := os.ReadFile(lock.Path())
+	assert.NoError(t, err)
+	assert.Equal(t, strconv.Itoa(os.Getpid()), string(owner))
+
+	// a reclaimed lock is still exclusive
+	waiting := newTestApp()
+	waiting.LockTimeout = 100 * time.Millisecond
+	reclaimed, err := app.lockHome(context.Background(), lock.Path())
+	assert.NoError(t, err)
+	assert.Equal(t, ErrHomeLocked, waiting.Init(home, &struct{}{}))
+	assert.NoError(t, reclaimed.Unlock())
+}
+
+func TestLockOwnerRecorded(t *testing.T) {
+	home := t.TempDir()
+	app := newTestApp()
+	assert.NoError(t, app.Init(home, &struct{}{}))
+	owner, err := os.ReadFile(filepath.Join(home, pathLock))
+	assert.NoError(t, err)
+	assert.Equal(t, strconv.Itoa(os.Getpid()), string(owner))
+}
+
+func TestHomeResolver(t *testing.T) {
+	resolved := t.TempDir()
+	app := newTestApp()
+	app.HomeResolver = func() (string, error) { return resolved, nil }
+	assert.NoError(t, app.Init("", &struct{}{}))
+	assert.Equal(t, resolved, app.Home)
+
+	explicit := t.TempDir()
+	app = newTestApp()
+	app.Home = explicit
+	app.HomeResolver = func() (string, error) { return "", errors.New("not called") }
+	assert.NoError(t, app.Init("", &struct{}{}))
+	assert.Equal(t, explicit, app.Home)
+
+	app = newTestApp()
+	app.HomeResolver = func() (string, error) { return "", errors.New("not ready") }
+	assert.Error(t, app.Init("", &struct{}{}))
+}
+
+func TestDataAndCacheHome(t *testing.T) {
+	home := t.TempDir()
+	app := newTestApp()
+	app.DataHome = filepath.Join(t.TempDir(), "data")
+	app.CacheHome = filepath.Join(t.TempDir(), "cache")
+	assert.NoError(t, app.Init(home, &struct{}{}))
+
+	assert.Equal(t, filepath.Join(app.CacheHome, pathEmbedded, "1.0.0"), app.EmbeddedPath)
+	assert.FileExists(t, filepath.Join(app.EmbeddedPath, "testdata/embedded/a.txt"))
+	assert.FileExists(t, filepath.Join(app.DataHome, pathVersion))
+	assert.FileExists(t, filepath.Join(home, pathLock))
+	assert.NoDirExists(t, filepath.Join(home, pathEmbedded))
+	assert.NoFileExists(t, filepath.Join(home, pathVersion))
+}
+
+func TestExtractionInProgress(t *testing.T) {
+	app := newTestApp()
+	app.Home = t.TempDir()
+	inProgress, err := app.ExtractionInProgress()
+	assert.NoError(t, err)
+	assert.False(t, inProgress)
+
+	exited := exec.Command("true")
+	assert.NoError(t, exited.Run())
+	staging := filepath.Join(app.Home, pathEmbedded, "1.0.0.tmp-"+strconv.Itoa(exited.Process.Pid))
+	assert.NoError(t, os.MkdirAll(staging, 0755))
+	inProgress, err = app.ExtractionInProgress()
+	assert.NoError(t, err)
+	assert.False(t, inProgress)
+
+	running := exec.Command("sleep", "10")
+	assert.NoError(t, running.Start())
+	defer func() {
+		_ = running.Process.Kill()
+		_ = running.Wait()
+	}()
+	assert.NoError(t, os.Rename(staging, filepath.Join(app.Home, pathEmbedded, "1.0.0.tmp-"+strconv.Itoa(running.Process.Pid))))
+	inProgress, err = app.ExtractionInProgress()
+	assert.NoError(t, err)
+	assert.True(t, inProgress)
+}
+
+func TestStatusReport(t *testing.T) {
+	home := t.TempDir()
+	app := newTestApp()
+	app.Home = home
+	status, err := app.StatusReport()
+	assert.NoError(t, err)
+	assert.Contains(t, status.Problems, "no version recorded in home")
+
+	assert.NoError(t, app.Init(home, &struct{}{}))
+	status, err = app.StatusReport()
+	assert.NoError(t, err)
+	assert.Equal(t, "1.0.0", status.HomeVersion)
+	assert.Equal(t, []string{"1.0.0"}, status.EmbeddedVersions)
+	assert.True(t, status.EmbeddedComplete)
+	assert.Empty(t, status.Problems)
+
+	assert.NoError(t, os.RemoveAll(app.EmbeddedPath))
+	upgraded := newTestApp()
+	upgraded.Version = "1.1.0"
+	upgraded.Home = home
+	upgraded.EmbeddedPath = app.EmbeddedPath
+	status, err = upgraded.StatusReport()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"recorded version 1.0.0 differs from running version 1.1.0",
+		"recorded version 1.0.0 has no extracted tree",
+		"embedded path is not completely extracted",
+	}, status.Problems)
+}
+
+func TestDryRun(t *testing.T) {
+	home := filepath.Join(t.TempDir(), "home")
+	app := newTestApp()
+	app.DryRun = true
+	assert.NoError(t, app.Init(home, &struct{}{}))
+	assert.NoDirExists(t, home)
+
+	app = newTestApp()
+	plan, err := app.PlanInit(home, &struct{}{})
+	assert.NoError(t, err)
+	assert.True(t, plan.CreateHome)
+	assert.True(t, plan.Extract)
+	assert.Equal(t, filepath.Join(home, pathEmbedded, "1.0.0"), plan.EmbeddedPath)
+
+	assert.NoError(t, app.Init(home, &struct{}{}))
+	for _, embeddedVersion := range []string{"0.0.8", "0.0.9", "0.1.0"} {
+		assert.NoError(t, os.MkdirAll(filepath.Join(home, pathEmbedded, embeddedVersion), 0755))
+	}
+	upgraded := newTestApp()
+	upgraded.Version = "1.1.0"
+	plan, err = upgraded.PlanInit(home, &struct{}{})
+	assert.NoError(t, err)
+	assert.False(t, plan.CreateHome)
+	assert.Equal(t, "1.0.0", plan.HomeVersion)
+	assert.True(t, plan.Extract)
+	assert.Equal(t, []string{"0.0.8", "0.0.9"}, plan.CleanupVersions)
+	assert.NoDirExists(t, filepath.Join(home, pathEmbedded, "1.1.0"))
+
+	upgraded.DryRun = true
+	_, err = upgraded.InitAsync(home, &struct{}{})
+	assert.Error(t, err)
+}
+
+func TestPlanInitRAMExtract(t *testing.T) {
+	withRAMRoot(t)
+	home := filepath.Join(t.TempDir(), "home")
+	app := newTestApp()
+	app.PreferRAMExtract = true
+	plan, err := app.PlanInit(home, &struct{}{})
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(app.ramEmbeddedRoot(), "1.0.0"), plan.EmbeddedPath)
+	assert.NoDirExists(t, app.ramEmbeddedRoot())
+}
+
+func TestStrictInit(t *testing.T) {
+	// a directory in place of the version file cannot be read, which is not a first run
+	home := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(home, pathVersion), 0755))
+	app := newTestApp()
+	assert.NoError(t, app.Init(home, &struct{}{}))
+	assert.DirExists(t, app.EmbeddedPath)
+
+	home = t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(home, pathVersion), 0755))
+	strict := newTestApp()
+	strict.StrictInit = true
+	assert.Error(t, strict.Init(home, &struct{}{}))
+	assert.NoDirExists(t, filepath.Join(home, pathEmbedded))
+}
+
+func TestPrepareOnly(t *testing.T) {
+	home := t.TempDir()
+	prepare := newTestApp()
+	prepare.PrepareOnly = true
+	assert.NoError(t, prepare.Init(home, &struct{}{}))
+	assert.FileExists(t, filepath.Join(prepare.EmbeddedPath, "testdata/embedded/a.txt"))
+	assert.NoFileExists(t, filepath.Join(home, pathVersion))
+	assert.FileExists(t, filepath.Join(home, pathPrepared))
+
+	app := newTestApp()
+	result, err := app.InitWithResult(home, &struct{}{})
+	assert.NoError(t, err)
+	assert.True(t, result.FirstRun)
+	assert.False(t, result.Extracted)
+	version, err := os.ReadFile(filepath.Join(home, pathVersion))
+	assert.NoError(t, err)
+	assert.Equal(t, "1.0.0", string(version))
+	assert.NoFileExists(t, filepath.Join(home, pathPrepared))
+}
+
+func TestInitWithResult(t *testing.T) {
+	home := t.TempDir()
+	result, err := newTestApp().InitWithResult(home, &struct{}{})
+	assert.NoError(t, err)
+	assert.True(t, result.FirstRun)
+	assert.True(t, result.Extracted)
+	assert.Equal(t, 4, result.FileCount)
+	assert.True(t, result.ExtractionComplete)
+
+	result, err = newTestApp().InitWithResult(home, &struct{}{})
+	assert.NoError(t, err)
+	assert.False(t, result.FirstRun)
+	assert.Equal(t, "1.0.0", result.PreviousVersion)
+	assert.False(t, result.Extracted)
+
+	for _, embeddedVersion := range []string{"0.0.1", "0.0.2"} {
+		assert.NoError(t, os.MkdirAll(filepath.Join(home, pathEmbedded, embeddedVersion), 0755))
+	}
+	upgraded := newTestApp()
+	upgraded.Version = "1.1.0"
+	result, err = upgraded.InitWithResult(home, &struct{}{})
+	assert.NoError(t, err)
+	assert.Equal(t, "1.0.0", result.PreviousVersion)
+	assert.True(t, result.Extracted)
+	assert.Equal(t, []string{"0.0.1"}, result.CleanedVersions)
+}
+
+type recordingHandler struct {
+	NopEventHandler
+	events []string
+}
+
+func (h *recordingHandler) OnHomeReady(home string) {
+	h.events = append(h.events, "home")
+}
+
+func (h *recordingHandler) OnConfigLoaded(path string) {
+	h.events = append(h.events, "config "+filepath.Base(path))
+}
+
+func (h *recordingHandler) OnExtractFinish(embeddedPath string, files int, err error) {
+	h.events = append(h.events, "extracted "+strconv.Itoa(files))
+}
+
+func (h *recordingHandler) OnCleanupDone(removed []string, err error) {
+	h.events = append(h.events, "cleanup")
+}
+
+type removingHandler struct {
+	NopEventHandler
+	path string
+}
+
+func (h *removingHandler) OnCleanupDone(removed []string, err error) {
+	_ = os.RemoveAll(h.path)
+}
+
+func TestInitMissingTreeAfterExtraction(t *testing.T) {
+	home := t.TempDir()
+	app := newTestApp()
+	app.Handlers = []EventHandler{&removingHandler{path: filepath.Join(home, pathEmbedded, "1.0.0")}}
+	err := app.Init(home, &struct{}{})
+	entry, ok := err.(*errs.EntryError)
+	if !assert.True(t, ok) {
+		return
+	}
+	assert.Equal(t, "No extracted embedded for current version after init", entry.Message)
+	assert.Equal(t, filepath.Join(home, pathEmbedded, "1.0.0"), entry.Fields["path"])
+}
+
+func TestEnsureDirs(t *testing.T) {
+	app := newTestApp()
+	app.EnsureDirs = []string{"logs", "data/cache"}
+	assert.NoError(t, app.Init(t.TempDir(), &struct{}{}))
+	assert.DirExists(t, filepath.Join(app.EmbeddedPath, "logs"))
+	assert.DirExists(t, filepath.Join(app.EmbeddedPath, "data/cache"))
+
+	app = newTestApp()
+	app.EnsureDirs = []string{"../outside"}
+	assert.Error(t, app.Init(t.TempDir(), &struct{}{}))
+}
+
+func TestEventHandlers(t *testing.T) {
+	handler := &recordingHandler{}
+	app := newTestApp()
+	app.Handlers = []EventHandler{handler}
+	assert.NoError(t, app.Init(t.TempDir(), &struct{}{}))
+	assert.Equal(t, []string{"home", "config " + pathConfig, "extracted 4", "cleanup"}, handler.events)
+}
@@ -0,0 +1,133 @@
+package app
+
+import (
+	"bytes"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"io"
+	"os"
+	"runtime"
+
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+)
+
+var elfArchs = map[elf.Machine]string{
+	elf.EM_386:       "386",
+	elf.EM_X86_64:    "amd64",
+	elf.EM_ARM:       "arm",
+	elf.EM_AARCH64:   "arm64",
+	elf.EM_RISCV:     "riscv64",
+	elf.EM_PPC64:     "ppc64",
+	elf.EM_S390:      "s390x",
+	elf.EM_MIPS:      "mips",
+	elf.EM_LOONGARCH: "loong64",
+}
+
+var machoArchs = map[macho.Cpu]string{
+	macho.Cpu386:   "386",
+	macho.CpuAmd64: "amd64",
+	macho.CpuArm:   "arm",
+	macho.CpuArm64: "arm64",
+	macho.CpuPpc64: "ppc64",
+}
+
+var peArchs = map[uint16]string{
+	pe.IMAGE_FILE_MACHINE_I386:  "386",
+	pe.IMAGE_FILE_MACHINE_AMD64: "amd64",
+	pe.IMAGE_FILE_MACHINE_ARMNT: "arm",
+	pe.IMAGE_FILE_MACHINE_ARM64: "arm64",
+}
+
+// verifyExecArch fails when path is an ELF, Mach-O or PE binary built for another architecture than the running one.
+// Other files are ignored
+func verifyExecArch(path string) error {
+	archs, err := binaryArchs(path)
+	if err != nil {
+		return errs.WithEF(err, data.WithField("path", path), "Failed to read binary header")
+	}
+	if archs == nil {
+		return nil
+	}
+	for _, arch := range archs {
+		if sameArch(arch, runtime.GOARCH) {
+			return nil
+		}
+	}
+	return errs.WithF(data.WithField("path", path).WithField("detected", archs).WithField("expected", runtime.GOARCH), "Extracted executable is built for another architecture")
+}
+
+func sameArch(detected string, goarch string) bool {
+	switch goarch {
+	case "ppc64le":
+		goarch = "ppc64"
+	case "mipsle", "mips64", "mips64le":
+		goarch = "mips"
+	}
+	return detected == goarch
+}
+
+// binaryArchs returns the architectures of a binary, nil if path is not a known binary format
+func binaryArchs(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(f, magic); err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case bytes.Equal(magic, []byte(elf.ELFMAG)):
+		file, err := elf.NewFile(f)
+		if err != nil {
+			return nil, err
+		}
+		return []string{archName(elfArchs[file.Machine], file.Machine.String())}, nil
+	case bytes.Equal(magic[:2], []byte("MZ")):
+		file, err := pe.NewFile(f)
+		if err != nil {
+			// MZ prefixed data that is not a PE
+			return nil, nil
+		}
+		return []string{archName(peArchs[file.Machine], "pe-unknown")}, nil
+	case isMachoMagic(magic):
+		if file, err := macho.NewFatFile(f); err == nil {
+			var archs []string
+			for _, arch := range file.Arches {
+				archs = append(archs, archName(machoArchs[arch.Cpu], arch.Cpu.String()))
+			}
+			return archs, nil
+		}
+		file, err := macho.NewFile(f)
+		if err != nil {
+			return nil, err
+		}
+		return []string{archName(machoArchs[file.Cpu], file.Cpu.String())}, nil
+	}
+	return nil, nil
+}
+
+func isMachoMagic(magic []byte) bool {
+	for _, m := range []uint32{macho.Magic32, macho.Magic64, macho.MagicFat} {
+		be := []byte{byte(m >> 24), byte(m >> 16), byte(m >> 8), byte(m)}
+		le := []byte{be[3], be[2], be[1], be[0]}
+		if bytes.Equal(magic, be) || bytes.Equal(magic, le) {
+			return true
+		}
+	}
+	return false
+}
+
+func archName(arch string, fallback string) string {
+	if arch == "" {
+		return fallback
+	}
+	return arch
+}
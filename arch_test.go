@@ -0,0 +1,21 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyExecArch(t *testing.T) {
+	executable, err := os.Executable()
+	assert.NoError(t, err)
+	assert.NoError(t, verifyExecArch(executable))
+
+	text := writeTestFile(t, filepath.Join(t.TempDir(), "script.sh"), "#!/bin/sh\necho ok\n")
+	archs, err := binaryArchs(text)
+	assert.NoError(t, err)
+	assert.Nil(t, archs)
+	assert.NoError(t, verifyExecArch(text))
+}
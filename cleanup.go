@@ -0,0 +1,198 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/n0rad/go-app/version"
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+)
+
+// EmbeddedVersions returns the names of the extracted embedded version directories, without staging ones
+func (app *App) EmbeddedVersions() ([]string, error) {
+	return embeddedVersionsIn(filepath.Join(app.cacheHome(), pathEmbedded))
+}
+
+func embeddedVersionsIn(root string) ([]string, error) {
+	dir, err := os.ReadDir(root)
+	if err != nil {
+		return nil, errs.WithE(err, "Failed to read home folder")
+	}
+	var embeddedVersions []string
+	for _, entry := range dir {
+		if isTempName(entry.Name()) {
+			continue
+		}
+		embeddedVersions = append(embeddedVersions, entry.Name())
+	}
+	return embeddedVersions, nil
+}
+
+// InstalledEmbeddedVersions returns the extracted embedded versions, newest first.
+// Directories whose name is not a semver are skipped with a warning
+func (app *App) InstalledEmbeddedVersions() ([]version.SemVersion, error) {
+	embeddedVersions, err := app.EmbeddedVersions()
+	if err != nil {
+		return nil, err
+	}
+	var installed []version.SemVersion
+	for _, embeddedVersion := range embeddedVersions {
+		parsed, err := version.Parse(embeddedVersion)
+		if err != nil {
+			app.logger().Warn(err, data.WithField("embedded", embeddedVersion), "Failed to read embedded version")
+			continue
+		}
+		installed = append(installed, parsed)
+	}
+	sort.Slice(installed, func(i, j int) bool {
+		return installed[i].Compare(installed[j]) > 0
+	})
+	return installed, nil
+}
+
+// EmbeddedPathFor returns the extracted embedded path of a given version and the configured channel,
+// in home or in RAM
+func (app *App) EmbeddedPathFor(embeddedVersion string) (string, error) {
+	if err := app.versionParser().Validate(embeddedVersion); err != nil {
+		return "", errs.WithEF(err, data.WithField("version", embeddedVersion), "Invalid embedded version")
+	}
+	path := filepath.Join(app.cacheHome(), pathEmbedded, embeddedVersion, app.EmbeddedChannel)
+	stat, err := os.Stat(path)
+	if err != nil {
+		if root, ok := app.trustedRAMRoot(); ok {
+			ramPath := filepath.Join(root, embeddedVersion, app.EmbeddedChannel)
+			if ramStat, ramErr := os.Stat(ramPath); ramErr == nil {
+				path, stat, err = ramPath, ramStat, nil
+			}
+		}
+	}
+	if err != nil {
+		return "", errs.WithEF(err, data.WithField("version", embeddedVersion).WithField("path", path), "Embedded version is not extracted")
+	} else if !stat.IsDir() {
+		return "", errs.WithF(data.WithField("version", embeddedVersion).WithField("path", path), "Embedded version is not a directory")
+	}
+	return path, nil
+}
+
+// CleanupPlan returns the embedded version directories that cleanup would remove, without removing anything
+func (app *App) CleanupPlan() ([]string, error) {
+	embeddedVersions, err := app.EmbeddedVersions()
+	if err != nil {
+		return nil, err
+	}
+	return app.retentionToRemove(filepath.Join(app.cacheHome(), pathEmbedded), embeddedVersions)
+}
+
+// retentionToRemove returns the embedded versions under root the retention policy removes, never the protected ones
+func (app *App) retentionToRemove(root string, embeddedVersions []string) ([]string, error) {
+	if app.StrictInit {
+		for _, embeddedVersion := range embeddedVersions {
+			if err := app.versionParser().Validate(embeddedVersion); err != nil {
+				return nil, errs.WithEF(err, data.WithField("embedded", embeddedVersion), "Failed to read embedded version")
+			}
+		}
+	}
+
+	app.sortEmbeddedVersions(embeddedVersions)
+	policy := app.RetentionPolicy
+	if policy == nil {
+		policy = KeepTotal{Count: app.retainedEmbeddedVersions()}
+	}
+	return app.unprotectedEmbedded(root, policy.ToRemove(embeddedVersions, app.Version)), nil
+}
+
+// unprotectedEmbedded filters out of embeddedVersions under root the directories still in use: the current version,
+// the one the App runs on, and fresh <version>+<pid> ones whose extracting process is alive
+func (app *App) unprotectedEmbedded(root string, embeddedVersions []string) []string {
+	var active string
+	if rel, err := filepath.Rel(root, app.EmbeddedPath); err == nil && filepath.IsLocal(rel) {
+		active, _, _ = strings.Cut(filepath.ToSlash(rel), "/")
+	}
+	var unprotected []string
+	for _, embeddedVersion := range embeddedVersions {
+		if embeddedVersion == app.Version || embeddedVersion == active || extractorAlive(embeddedVersion) {
+			continue
+		}
+		unprotected = append(unprotected, embeddedVersion)
+	}
+	return unprotected
+}
+
+// extractorAlive tells whether embeddedVersion is a fresh <version>+<pid> directory of a live process
+func extractorAlive(embeddedVersion string) bool {
+	i := strings.LastIndex(embeddedVersion, "+")
+	if i < 0 {
+		return false
+	}
+	pid, err := strconv.Atoi(embeddedVersion[i+1:])
+	return err == nil && pid > 0 && processAlive(pid)
+}
+
+func (app *App) sortEmbeddedVersions(embeddedVersions []string) {
+	parser := app.versionParser()
+	sort.Slice(embeddedVersions, func(i, j int) bool {
+		compare, err := parser.Compare(embeddedVersions[i], embeddedVersions[j])
+		if err != nil {
+			app.logger().Warn(err, data.WithField("embedded", embeddedVersions[i]).WithField("other", embeddedVersions[j]), "Failed to read embedded version")
+			return false
+		}
+		return compare < 0
+	})
+}
+
+func (app *App) retainedEmbeddedVersions() int {
+	if app.RetainedEmbeddedVersions < 1 {
+		return defaultRetainedEmbeddedVersions
+	}
+	return app.RetainedEmbeddedVersions
+}
+
+// cleanupEmbedded removes the embedded versions selected by the retention policy, in home and in RAM,
+// returning the removed ones
+func (app *App) cleanupEmbedded() ([]string, error) {
+	var cleaned []string
+	// nothing is extracted in home when it is in RAM
+	homeRoot := filepath.Join(app.cacheHome(), pathEmbedded)
+	if _, err := os.Stat(homeRoot); !os.IsNotExist(err) {
+		if cleaned, err = app.cleanupEmbeddedIn(homeRoot); err != nil {
+			return cleaned, err
+		}
+	}
+	if root, ok := app.trustedRAMRoot(); ok {
+		ramCleaned, err := app.cleanupEmbeddedIn(root)
+		for _, embeddedVersion := range ramCleaned {
+			if !slices.Contains(cleaned, embeddedVersion) {
+				cleaned = append(cleaned, embeddedVersion)
+			}
+		}
+		if err != nil {
+			return cleaned, err
+		}
+	}
+	return cleaned, nil
+}
+
+func (app *App) cleanupEmbeddedIn(root string) ([]string, error) {
+	embeddedVersions, err := embeddedVersionsIn(root)
+	if err != nil {
+		return nil, err
+	}
+	toCleanup, err := app.retentionToRemove(root, embeddedVersions)
+	if err != nil {
+		return nil, err
+	}
+	var cleaned []string
+	for _, embeddedVersion := range toCleanup {
+		toCleanupPath := filepath.Join(root, embeddedVersion)
+		if err := removeTree(toCleanupPath); err != nil {
+			return cleaned, errs.WithEF(err, data.WithField("folder", toCleanupPath), "Failed to cleanup old embedded")
+		}
+		cleaned = append(cleaned, embeddedVersion)
+	}
+	return cleaned, nil
+}
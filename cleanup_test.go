@@ -0,0 +1,244 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gofrs/flock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCleanupEmbeddedRemovesAllStaleVersions(t *testing.T) {
+	app := &App{Name: "test", Home: t.TempDir(), Version: "1.0.1", RetainedEmbeddedVersions: 2}
+	for _, embeddedVersion := range []string{"1.0.0", "1.0.1", "1.0.2", "1.0.3", "1.0.4", "1.0.10"} {
+		assert.NoError(t, os.MkdirAll(filepath.Join(app.Home, pathEmbedded, embeddedVersion), 0755))
+	}
+
+	cleaned, err := app.cleanupEmbedded()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1.0.0", "1.0.2", "1.0.3"}, cleaned)
+	embeddedVersions, err := app.EmbeddedVersions()
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"1.0.1", "1.0.4", "1.0.10"}, embeddedVersions)
+
+	app.RetainedEmbeddedVersions = 0
+	_, err = app.cleanupEmbedded()
+	assert.NoError(t, err)
+	embeddedVersions, err = app.EmbeddedVersions()
+	assert.NoError(t, err)
+	assert.Len(t, embeddedVersions, 3)
+}
+
+func TestCleanupPlan(t *testing.T) {
+	app := &App{Name: "test", Home: t.TempDir(), Version: "1.0.1", RetainedEmbeddedVersions: 2}
+	for _, embeddedVersion := range []string{"1.0.0", "1.0.1", "1.0.2", "1.0.3"} {
+		assert.NoError(t, os.MkdirAll(filepath.Join(app.Home, pathEmbedded, embeddedVersion), 0755))
+	}
+
+	planned, err := app.CleanupPlan()
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"1.0.0"}, planned)
+	embeddedVersions, err := app.EmbeddedVersions()
+	assert.NoError(t, err)
+	assert.Len(t, embeddedVersions, 4)
+
+	cleaned, err := app.cleanupEmbedded()
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, planned, cleaned)
+}
+
+func TestInitRetainedEmbeddedVersions(t *testing.T) {
+	for retained, expected := range map[int][]string{
+		0: {"1.0.1", "1.0.2", "1.0.3"},
+		1: {"1.0.3"},
+		2: {"1.0.2", "1.0.3"},
+	} {
+		home := t.TempDir()
+		for _, embeddedVersion := range []string{"1.0.0", "1.0.1", "1.0.2", "1.0.3"} {
+			app := newTestApp()
+			app.Version = embeddedVersion
+			app.RetainedEmbeddedVersions = retained
+			assert.NoError(t, app.Init(home, &struct{}{}))
+		}
+		embeddedVersions, err := (&App{Name: "test", Home: home}).EmbeddedVersions()
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, expected, embeddedVersions, "retained %d", retained)
+	}
+}
+
+func TestInstalledEmbeddedVersions(t *testing.T) {
+	app := &App{Name: "test", Home: t.TempDir()}
+	for _, embeddedVersion := range []string{"1.0.2", "not-a-version", "1.0.10", "1.0.0", "1.0.3.tmp-42"} {
+		assert.NoError(t, os.MkdirAll(filepath.Join(app.Home, pathEmbedded, embeddedVersion), 0755))
+	}
+
+	installed, err := app.InstalledEmbeddedVersions()
+	assert.NoError(t, err)
+	var names []string
+	for _, v := range installed {
+		names = append(names, v.String())
+	}
+	assert.Equal(t, []string{"1.0.10", "1.0.2", "1.0.0"}, names)
+}
+
+func TestEmbeddedPathFor(t *testing.T) {
+	app := newTestApp()
+	app.EmbeddedChannel = "testdata"
+	assert.NoError(t, app.Init(t.TempDir(), &struct{}{}))
+	path, err := app.EmbeddedPathFor("1.0.0")
+	assert.NoError(t, err)
+	assert.Equal(t, app.EmbeddedPath, path)
+	_, err = app.EmbeddedPathFor("0.9.0")
+	assert.Error(t, err)
+
+	withRAMRoot(t)
+	inRAM := newTestApp()
+	inRAM.PreferRAMExtract = true
+	assert.NoError(t, inRAM.Init(t.TempDir(), &struct{}{}))
+	path, err = inRAM.EmbeddedPathFor("1.0.0")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(inRAM.ramEmbeddedRoot(), "1.0.0"), path)
+}
+
+func TestCleanupEmbeddedVPrefixedVersions(t *testing.T) {
+	app := &App{Name: "test", Home: t.TempDir(), Version: "v1.0.1", RetainedEmbeddedVersions: 1}
+	for _, embeddedVersion := range []string{"v1.0.0", "v1.0.1", "v1.0.2", "v1.0.10"} {
+		assert.NoError(t, os.MkdirAll(filepath.Join(app.Home, pathEmbedded, embeddedVersion), 0755))
+	}
+
+	cleaned, err := app.cleanupEmbedded()
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"v1.0.0", "v1.0.2"}, cleaned)
+}
+
+func TestCleanupEmbeddedKeepCurrentAndNewest(t *testing.T) {
+	app := &App{Name: "test", Home: t.TempDir(), Version: "1.0.1", RetentionPolicy: KeepCurrentAndNewest{Count: 2}}
+	for _, embeddedVersion := range []string{"1.0.0", "1.0.1", "1.0.2", "1.0.3", "1.0.10"} {
+		assert.NoError(t, os.MkdirAll(filepath.Join(app.Home, pathEmbedded, embeddedVersion), 0755))
+	}
+
+	cleaned, err := app.cleanupEmbedded()
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"1.0.0", "1.0.2"}, cleaned)
+	embeddedVersions, err := app.EmbeddedVersions()
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"1.0.1", "1.0.3", "1.0.10"}, embeddedVersions)
+}
+
+type buildNumberParser struct{}
+
+func (buildNumberParser) Validate(v string) error {
+	_, err := strconv.Atoi(v)
+	return err
+}
+
+func (buildNumberParser) Compare(a, b string) (int, error) {
+	x, err := strconv.Atoi(a)
+	if err != nil {
+		return 0, err
+	}
+	y, err := strconv.Atoi(b)
+	if err != nil {
+		return 0, err
+	}
+	return x - y, nil
+}
+
+func TestCustomVersionParser(t *testing.T) {
+	home := t.TempDir()
+	for _, embeddedVersion := range []string{"2", "9"} {
+		assert.NoError(t, os.MkdirAll(filepath.Join(home, pathEmbedded, embeddedVersion), 0755))
+	}
+	app := newTestApp()
+	app.Version = "10"
+	app.VersionParser = buildNumberParser{}
+	app.RetainedEmbeddedVersions = 2
+	assert.NoError(t, app.Init(home, &struct{}{}))
+
+	embeddedVersions, err := app.EmbeddedVersions()
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"9", "10"}, embeddedVersions)
+
+	app.Version = "1.0.0"
+	assert.Error(t, app.Init(home, &struct{}{}))
+}
+
+func TestVacuumKeepsEmbeddedInUse(t *testing.T) {
+	app := &App{Name: "test", Home: t.TempDir(), Version: "1.0.1", RetainedEmbeddedVersions: 1}
+	// the App runs on a fresh directory and another live process extracted its own
+	active := "1.0.1+" + strconv.Itoa(os.Getpid())
+	other := "1.0.0+" + strconv.Itoa(os.Getppid())
+	for _, embeddedVersion := range []string{"1.0.0", "1.0.1", active, other, "1.0.1+2147483647"} {
+		assert.NoError(t, os.MkdirAll(filepath.Join(app.Home, pathEmbedded, embeddedVersion), 0755))
+	}
+	app.EmbeddedPath = filepath.Join(app.Home, pathEmbedded, active)
+
+	cleaned, err := app.cleanupEmbedded()
+	assert.NoError(t, err)
+	assert.NotContains(t, cleaned, active)
+	assert.NotContains(t, cleaned, other)
+
+	_, err = app.Vacuum()
+	assert.NoError(t, err)
+	embeddedVersions, err := app.EmbeddedVersions()
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"1.0.1", active, other}, embeddedVersions)
+}
+
+func TestVacuumRemovesOrphanedMarkers(t *testing.T) {
+	home := t.TempDir()
+	app := newTestApp()
+	app.Version = "1.0.1"
+	assert.NoError(t, app.Init(home, &struct{}{}))
+	assert.NoError(t, os.MkdirAll(filepath.Join(home, pathEmbedded, "1.0.0"), 0755))
+	writeTestFile(t, app.pidsPath("1.0.0"), "2147483647\n")
+	writeTestFile(t, app.pidsPath("1.0.1"), strconv.Itoa(os.Getpid())+"\n")
+	writeTestFile(t, filepath.Join(home, pathPrepared), "1.0.0")
+
+	_, err := app.Vacuum()
+	assert.NoError(t, err)
+	assert.NoDirExists(t, filepath.Join(home, pathEmbedded, "1.0.0"))
+	assert.NoFileExists(t, app.pidsPath("1.0.0"))
+	assert.NoFileExists(t, filepath.Join(home, pathPrepared))
+	assert.FileExists(t, app.pidsPath("1.0.1"))
+	owner, err := os.ReadFile(filepath.Join(home, pathLock))
+	assert.NoError(t, err)
+	assert.Equal(t, strconv.Itoa(os.Getpid()), string(owner))
+}
+
+func TestVacuumRemovesDeadFreshTrees(t *testing.T) {
+	home := t.TempDir()
+	app := newTestApp()
+	app.SafeReextract = true
+	assert.NoError(t, app.Init(home, &struct{}{}))
+	used := app.EmbeddedPath
+
+	// left by a process that extracted next to a used embedded then exited
+	dead := used + "+2147483647"
+	writeTestFile(t, filepath.Join(dead, "testdata/embedded/a.txt"), "first\n")
+	assert.NoError(t, os.WriteFile(filepath.Join(home, pathVersion), []byte("0.9.0"), 0644))
+
+	again := newTestApp()
+	again.SafeReextract = true
+	assert.NoError(t, again.Init(home, &struct{}{}))
+	assert.Equal(t, used, again.EmbeddedPath)
+
+	_, err := again.Vacuum()
+	assert.NoError(t, err)
+	assert.NoDirExists(t, dead)
+	assert.FileExists(t, filepath.Join(used, "testdata/embedded/a.txt"))
+}
+
+func TestVacuumLockTimeout(t *testing.T) {
+	home := t.TempDir()
+	lock := flock.New(filepath.Join(home, pathLock))
+	assert.NoError(t, lock.Lock())
+	defer lock.Unlock()
+
+	app := &App{Name: "test", Home: home, Version: "1.0.0", LockTimeout: 100 * time.Millisecond}
+	_, err := app.Vacuum()
+	assert.Equal(t, ErrHomeLocked, err)
+}
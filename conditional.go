@@ -0,0 +1,70 @@
+package app
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// conditionalSkips returns the ExtractIf prefixes whose predicate is currently false
+func (app *App) conditionalSkips() []string {
+	var skips []string
+	for prefix, predicate := range app.ExtractIf {
+		if !predicate() {
+			skips = append(skips, strings.Trim(prefix, "/"))
+		}
+	}
+	return skips
+}
+
+// missingConditional tells whether a conditional subtree now enabled is embedded but was not extracted
+func (app *App) missingConditional() bool {
+	if len(app.ExtractIf) == 0 {
+		return false
+	}
+	ignore, err := app.readEmbeddedIgnore()
+	if err != nil {
+		// extraction fails on it as well
+		return false
+	}
+	e := &extraction{channel: app.EmbeddedChannel, ignore: ignore}
+	if app.EmbeddedLocaleDir != "" && len(app.Locales) > 0 {
+		e.localeDir = strings.Trim(app.EmbeddedLocaleDir, "/")
+		e.locales = app.Locales
+	}
+	return e.missingConditional(app.embeddedFS(), app.ExtractIf, app.EmbeddedPath)
+}
+
+// missingConditional tells whether a subtree of conditions now enabled, and not otherwise excluded, is not in extracted
+func (e *extraction) missingConditional(fsys fs.FS, conditions map[string]func() bool, extracted string) bool {
+	for prefix, predicate := range conditions {
+		prefix = strings.Trim(prefix, "/")
+		stat, err := fs.Stat(fsys, prefix)
+		if err != nil || !predicate() {
+			continue
+		}
+		// a subtree excluded by locales or ignore rules, or outside of the channel, is never extracted
+		entry := embeddedEntry{path: prefix, dir: stat.IsDir(), regular: stat.Mode().IsRegular()}
+		if e.excludedLocale(entry) || e.skippedIgnored(entry) {
+			continue
+		}
+		rel, ok := e.channelPath(prefix)
+		if !ok {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(extracted, rel)); err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *extraction) skippedConditional(path string) bool {
+	for _, prefix := range e.conditionalSkips {
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,324 @@
+package app
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"time"
+
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	configSourceDefault = "default"
+	configSourceBytes   = "bytes"
+)
+
+// configReadRetryDelay is the wait before reading again a config file that failed to parse, replaceable in tests
+var configReadRetryDelay = 100 * time.Millisecond
+
+// ConfigValidator is implemented by configs checking their own invariants, once loaded by LoadConfig
+type ConfigValidator interface {
+	Validate() error
+}
+
+// LoadConfig loads the system config files, then the config file which overrides them.
+// A top level include list loads other files first, relative to the including one
+func (app *App) LoadConfig(self any) error {
+	app.config = self
+	for _, systemPath := range app.systemConfigPaths() {
+		if err := app.loadConfigFile(systemPath, systemPath, self, nil); err != nil {
+			return err
+		}
+	}
+
+	configFullPath, err := app.configPath()
+	if err != nil {
+		return err
+	}
+	if app.VerifyConfigChecksum {
+		if err := verifyConfigChecksum(configFullPath); err != nil {
+			return err
+		}
+	}
+	if err := app.loadConfigFile(configFullPath, filepath.Base(configFullPath), self, nil); err != nil {
+		return err
+	}
+
+	if validator, ok := self.(ConfigValidator); ok {
+		if err := validator.Validate(); err != nil {
+			return errs.WithEF(err, data.WithField("path", configFullPath), "Invalid config")
+		}
+	}
+	return nil
+}
+
+// loadConfigFile unmarshals a config file onto self, after the files it includes, a missing file is skipped.
+// visited holds the files being loaded up to this one, to detect include cycles
+func (app *App) loadConfigFile(configFullPath string, source string, self any, visited map[string]bool) error {
+	if stat, err := os.Stat(configFullPath); os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return errs.WithEF(err, data.WithField("path", configFullPath), "Failed to stat config file")
+	} else if stat.IsDir() {
+		return errs.WithF(data.WithField("path", configFullPath), "Folder found on config location")
+	}
+
+	bytes, err := app.readConfigFile(configFullPath)
+	if err != nil {
+		return err
+	}
+	if emptyConfig(bytes) {
+		return nil
+	}
+
+	for retry := 0; ; retry++ {
+		includes, rest, err := splitConfigIncludes(bytes)
+		if err == nil {
+			if err := app.loadConfigIncludes(configFullPath, includes, self, visited); err != nil {
+				return err
+			}
+			if err = app.unmarshalConfig(rest, source, self); err == nil {
+				return nil
+			}
+		}
+		if retry >= app.ConfigReadRetries {
+			return errs.WithEF(err, data.WithField("content", string(bytes)).WithField("path", configFullPath), "Failed to parse config file")
+		}
+		// the file may be caught while another process writes it
+		app.logger().Debug(err, data.WithField("path", configFullPath).WithField("retry", retry+1), "Failed to parse config file, retrying")
+		time.Sleep(configReadRetryDelay)
+		if bytes, err = app.readConfigFile(configFullPath); err != nil {
+			return err
+		}
+	}
+}
+
+// LoadConfigLayers unmarshals config files in order onto the loaded config, or onto the App when none is loaded,
+// so later files override the keys of earlier ones. Missing files are skipped
+func (app *App) LoadConfigLayers(paths ...string) error {
+	var self any = app
+	if app.config != nil {
+		self = app.config
+	}
+	for _, path := range paths {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			app.logger().Debug(nil, data.WithField("path", path), "Config layer not found, skipping")
+			continue
+		}
+		if err := app.loadConfigFile(path, path, self, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadConfigFrom unmarshals the yaml config read from r onto the loaded config, or onto the App when none is loaded
+func (app *App) LoadConfigFrom(r io.Reader) error {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return errs.WithE(err, "Failed to read config")
+	}
+	return app.LoadConfigBytes(content)
+}
+
+// LoadConfigBytes unmarshals a yaml config onto the loaded config, or onto the App when none is loaded
+func (app *App) LoadConfigBytes(b []byte) error {
+	var self any = app
+	if app.config != nil {
+		self = app.config
+	}
+	if err := app.unmarshalConfig(b, configSourceBytes, self); err != nil {
+		return errs.WithEF(err, data.WithField("content", string(b)), "Failed to parse config")
+	}
+	return nil
+}
+
+// emptyConfig reports whether a yaml config has no document content, like a blank or `---` only file
+func emptyConfig(content []byte) bool {
+	var document yaml.Node
+	if err := yaml.Unmarshal(content, &document); err != nil {
+		return false
+	}
+	return len(document.Content) == 0 || document.Content[0].Tag == "!!null"
+}
+
+// unmarshalConfig unmarshals a yaml config onto self and records source as the origin of its keys
+func (app *App) unmarshalConfig(content []byte, source string, self any) error {
+	if err := yaml.Unmarshal(content, self); err != nil {
+		return err
+	}
+	var values map[string]any
+	if err := yaml.Unmarshal(content, &values); err == nil {
+		app.recordConfigSource(values, source)
+	}
+	return nil
+}
+
+// readConfigFile returns the content of a config file converted to yaml
+func (app *App) readConfigFile(configFullPath string) ([]byte, error) {
+	content, err := os.ReadFile(configFullPath)
+	if err != nil {
+		return nil, errs.WithEF(err, data.WithField("path", configFullPath), "Failed to read config file")
+	}
+	converted, err := configToYAML(configFormat(configFullPath), content)
+	if err != nil {
+		return nil, errs.WithEF(err, data.WithField("path", configFullPath), "Failed to parse config file")
+	}
+	return converted, nil
+}
+
+func (app *App) systemConfigPaths() []string {
+	if app.SystemConfigPaths != nil {
+		return app.SystemConfigPaths
+	}
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	return []string{filepath.Join("/etc", app.Name, pathConfig)}
+}
+
+// ValidateConfigFile loads a config file as LoadConfig would, over the system config files and with its includes,
+// into a new config of the loaded config type that is then validated, without applying it to the running App
+func (app *App) ValidateConfigFile(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return errs.WithEF(err, data.WithField("path", path), "Failed to find config file")
+	}
+	candidate, err := app.loadConfigCandidate(path)
+	if err != nil {
+		return err
+	}
+	if validator, ok := candidate.(ConfigValidator); ok {
+		if err := validator.Validate(); err != nil {
+			return errs.WithEF(err, data.WithField("path", path), "Invalid config")
+		}
+	}
+	return nil
+}
+
+// loadConfigCandidate loads the system config layers and a config file with its includes onto a new config,
+// like LoadConfig but without touching the running one
+func (app *App) loadConfigCandidate(path string) (any, error) {
+	candidate, err := app.newConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	// sources recorded while loading the candidate describe it, not the running config
+	sources := app.configSources
+	app.configSources = nil
+	defer func() { app.configSources = sources }()
+
+	for _, systemPath := range app.systemConfigPaths() {
+		if err := app.loadConfigFile(systemPath, systemPath, candidate, nil); err != nil {
+			return nil, err
+		}
+	}
+	if err := app.loadConfigFile(path, filepath.Base(path), candidate, nil); err != nil {
+		return nil, err
+	}
+	return candidate, nil
+}
+
+// newConfig returns a pointer to a new zero value of the loaded config type
+func (app *App) newConfig() (any, error) {
+	if app.config == nil {
+		return nil, errs.With("Config must be loaded before its type can be used")
+	}
+	configType := reflect.TypeOf(app.config)
+	if configType.Kind() != reflect.Pointer {
+		return nil, errs.WithF(data.WithField("type", configType.String()), "Config must be a pointer")
+	}
+	return reflect.New(configType.Elem()).Interface(), nil
+}
+
+// configPath returns the config file to use: ConfigPath when set, with ConfigSearchUpward the nearest .<name>.yaml
+// in the working directory or its parents, otherwise the Home config of the first existing format.
+// When none exists, the Home config of the first format is returned
+func (app *App) configPath() (string, error) {
+	if app.ConfigPath != "" {
+		return app.ConfigPath, nil
+	}
+	if app.ConfigSearchUpward {
+		if path := app.searchConfigUpward(); path != "" {
+			return path, nil
+		}
+	}
+	return app.homeConfigPath()
+}
+
+// homeConfigPath returns the Home config file of the first existing format, or of the first format when none exists
+func (app *App) homeConfigPath() (string, error) {
+	var found []string
+	for _, format := range app.configFormats() {
+		path := filepath.Join(app.Home, pathConfigName+"."+format)
+		if _, err := os.Stat(path); err == nil {
+			found = append(found, path)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return filepath.Join(app.Home, pathConfigName+"."+app.configFormats()[0]), nil
+	case 1:
+		return found[0], nil
+	}
+	return "", errs.WithF(data.WithField("files", found), "Multiple config files found in home, keep only one")
+}
+
+func (app *App) searchConfigUpward() string {
+	dir, err := workingDir()
+	if err != nil {
+		app.logger().Warn(err, nil, "Failed to get working directory to search config")
+		return ""
+	}
+	for {
+		path := filepath.Join(dir, "."+app.Name+".yaml")
+		if stat, err := os.Stat(path); err == nil && !stat.IsDir() {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// ConfigSource returns where the resolved value of a dotted config key comes from,
+// like "config.yaml", or "default" when no source set it
+func (app *App) ConfigSource(key string) string {
+	if source, ok := app.configSources[key]; ok {
+		return source
+	}
+	return configSourceDefault
+}
+
+func (app *App) recordConfigSource(values map[string]any, source string) {
+	if app.configSources == nil {
+		app.configSources = map[string]string{}
+	}
+	for key := range flattenConfig(values) {
+		app.configSources[key] = source
+	}
+}
+
+// flattenConfig returns every key of a parsed config, nested ones as dotted paths, with its value
+func flattenConfig(values map[string]any) map[string]any {
+	flat := map[string]any{}
+	flattenConfigInto(flat, "", values)
+	return flat
+}
+
+func flattenConfigInto(flat map[string]any, prefix string, values map[string]any) {
+	for key, value := range values {
+		fullKey := prefix + key
+		flat[fullKey] = value
+		if nested, ok := value.(map[string]any); ok {
+			flattenConfigInto(flat, fullKey+".", nested)
+		}
+	}
+}
@@ -0,0 +1,404 @@
+package app
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeTestFile(t *testing.T, path string, content string) string {
+	assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func TestValidateConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	config := &testConfig{}
+	config.SystemConfigPaths = []string{}
+	config.config = config
+
+	assert.NoError(t, config.ValidateConfigFile(writeTestFile(t, filepath.Join(dir, "valid.yaml"), "server:\n  port: 80\n")))
+	// unknown keys are accepted, as by LoadConfig
+	assert.NoError(t, config.ValidateConfigFile(writeTestFile(t, filepath.Join(dir, "unknown.yaml"), "server:\n  prt: 80\n")))
+	assert.Error(t, config.ValidateConfigFile(writeTestFile(t, filepath.Join(dir, "invalid.yaml"), "server:\n  port: http\n")))
+	assert.Error(t, config.ValidateConfigFile(filepath.Join(dir, "missing.yaml")))
+	assert.Equal(t, 0, config.Server.Port)
+
+	writeTestFile(t, filepath.Join(dir, "broken.yaml"), "server:\n  port: http\n")
+	assert.Error(t, config.ValidateConfigFile(writeTestFile(t, filepath.Join(dir, "including.yaml"), "include: [broken.yaml]\n")))
+	assert.Error(t, config.ValidateConfigFile(writeTestFile(t, filepath.Join(dir, "missing-include.yaml"), "include: [nowhere.yaml]\n")))
+}
+
+func TestValidateConfigFileRunsValidate(t *testing.T) {
+	dir := t.TempDir()
+	config := &testValidatedConfig{App: &App{Name: "test", Home: dir, SystemConfigPaths: []string{}}}
+	writeTestFile(t, filepath.Join(dir, pathConfig), "port: 80\n")
+	assert.NoError(t, config.LoadConfig(config))
+
+	assert.Error(t, config.ValidateConfigFile(writeTestFile(t, filepath.Join(dir, "zero.yaml"), "port: 0\n")))
+	writeTestFile(t, filepath.Join(dir, "port.yaml"), "port: 8080\n")
+	assert.NoError(t, config.ValidateConfigFile(writeTestFile(t, filepath.Join(dir, "included.yaml"), "include: [port.yaml]\n")))
+	assert.Equal(t, 80, config.Port)
+	assert.Equal(t, pathConfig, config.ConfigSource("port"))
+}
+
+type testAppConfig struct {
+	*App
+	Server testConfigServer `yaml:"server"`
+}
+
+func TestConfigDiff(t *testing.T) {
+	config := &testAppConfig{App: &App{Name: "test", Home: t.TempDir()}}
+	writeTestFile(t, filepath.Join(config.Home, pathConfig), "server:\n  host: localhost\n  port: 80\n")
+	assert.NoError(t, config.LoadConfig(config))
+
+	diff, err := config.ConfigDiff()
+	assert.NoError(t, err)
+	assert.Empty(t, diff)
+
+	config.Server.Port = 8080
+	diff, err = config.ConfigDiff()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"server.port": 8080}, diff)
+}
+
+func TestConfigDiffSystemLayersAndIncludes(t *testing.T) {
+	system := writeTestFile(t, filepath.Join(t.TempDir(), "config.yaml"), "logLevel: info\n")
+	config := &testConfig{App: App{Name: "test", Home: t.TempDir(), SystemConfigPaths: []string{system}}}
+	writeTestFile(t, filepath.Join(config.Home, "server.yaml"), "server:\n  host: included\n")
+	writeTestFile(t, filepath.Join(config.Home, pathConfig), "include: [server.yaml]\nserver:\n  port: 80\n")
+	assert.NoError(t, config.LoadConfig(config))
+
+	diff, err := config.ConfigDiff()
+	assert.NoError(t, err)
+	assert.Empty(t, diff)
+}
+
+func TestConfigSearchUpward(t *testing.T) {
+	project := t.TempDir()
+	nested := filepath.Join(project, "a", "b")
+	assert.NoError(t, os.MkdirAll(nested, 0755))
+	withHomeLookups(t, nil, "/home/user", nested)
+
+	app := &App{Name: "myapp", Home: t.TempDir(), ConfigSearchUpward: true}
+	path, err := app.configPath()
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(app.Home, pathConfig), path)
+
+	projectConfig := writeTestFile(t, filepath.Join(project, ".myapp.yaml"), "server:\n  port: 80\n")
+	path, err = app.configPath()
+	assert.NoError(t, err)
+	assert.Equal(t, projectConfig, path)
+}
+
+func TestLoadConfigSystemPaths(t *testing.T) {
+	system := writeTestFile(t, filepath.Join(t.TempDir(), "config.yaml"), "server:\n  host: system\n  port: 80\nlogLevel: info\n")
+	config := &testConfig{App: App{Name: "test", Home: t.TempDir(), SystemConfigPaths: []string{system, "/does/not/exist.yaml"}}}
+	writeTestFile(t, filepath.Join(config.Home, pathConfig), "server:\n  port: 8080\n")
+
+	assert.NoError(t, config.LoadConfig(config))
+	assert.Equal(t, "system", config.Server.Host)
+	assert.Equal(t, 8080, config.Server.Port)
+	assert.Equal(t, "info", config.LogLevel)
+	assert.Equal(t, pathConfig, config.ConfigSource("server.port"))
+	assert.Equal(t, system, config.ConfigSource("server.host"))
+	assert.Equal(t, "default", config.ConfigSource("tags"))
+}
+
+func TestLoadConfigBytes(t *testing.T) {
+	config := &testConfig{App: App{Name: "test", Home: t.TempDir()}}
+	assert.NoError(t, config.LoadConfig(config))
+
+	assert.NoError(t, config.LoadConfigBytes([]byte("server:\n  host: remote\n")))
+	assert.NoError(t, config.LoadConfigFrom(strings.NewReader("server:\n  port: 8080\n")))
+	assert.Equal(t, "remote", config.Server.Host)
+	assert.Equal(t, 8080, config.Server.Port)
+	assert.Equal(t, "bytes", config.ConfigSource("server.port"))
+
+	assert.Error(t, config.LoadConfigBytes([]byte("server: [")))
+}
+
+func TestLoadConfigLayers(t *testing.T) {
+	dir := t.TempDir()
+	base := writeTestFile(t, filepath.Join(dir, "base.yaml"), "server:\n  host: base\n  port: 80\ntags: [a]\n")
+	env := writeTestFile(t, filepath.Join(dir, "prod.yaml"), "server:\n  port: 443\n")
+
+	config := &testConfig{App: App{Name: "test", Home: t.TempDir()}}
+	assert.NoError(t, config.LoadConfig(config))
+	assert.NoError(t, config.LoadConfigLayers(base, filepath.Join(dir, "missing.yaml"), env))
+	assert.Equal(t, "base", config.Server.Host)
+	assert.Equal(t, 443, config.Server.Port)
+	assert.Equal(t, []string{"a"}, config.Tags)
+	assert.Equal(t, env, config.ConfigSource("server.port"))
+}
+
+func TestLoadConfigInclude(t *testing.T) {
+	config := &testConfig{App: App{Name: "test", Home: t.TempDir()}}
+	writeTestFile(t, filepath.Join(config.Home, "server.yaml"), "server:\n  host: included\n  port: 80\n")
+	writeTestFile(t, filepath.Join(config.Home, pathConfig), "include: [server.yaml]\nserver:\n  port: 8080\n")
+
+	assert.NoError(t, config.LoadConfig(config))
+	assert.Equal(t, "included", config.Server.Host)
+	assert.Equal(t, 8080, config.Server.Port)
+	assert.NoError(t, config.ValidateConfigFile(filepath.Join(config.Home, pathConfig)))
+
+	writeTestFile(t, filepath.Join(config.Home, "server.yaml"), "include: [config.yaml]\n")
+	assert.Error(t, config.LoadConfig(config))
+}
+
+func TestLoadConfigEmptyFile(t *testing.T) {
+	for _, content := range []string{"", "---\n"} {
+		config := &testConfig{App: App{Name: "test", Home: t.TempDir()}}
+		config.Server.Host = "kept"
+		writeTestFile(t, filepath.Join(config.Home, pathConfig), content)
+
+		assert.NoError(t, config.LoadConfig(config))
+		assert.Equal(t, "kept", config.Server.Host)
+		assert.Equal(t, "default", config.ConfigSource("server.host"))
+	}
+}
+
+func TestConfigReadRetries(t *testing.T) {
+	previousDelay := configReadRetryDelay
+	t.Cleanup(func() { configReadRetryDelay = previousDelay })
+	configReadRetryDelay = 300 * time.Millisecond
+
+	config := &testConfig{App: App{Name: "test", Home: t.TempDir(), SystemConfigPaths: []string{}}}
+	configPath := writeTestFile(t, filepath.Join(config.Home, pathConfig), "server:\n  port: [80")
+	assert.Error(t, config.LoadConfig(config))
+
+	config.ConfigReadRetries = 2
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		writeTestFile(t, configPath+".tmp", "server:\n  port: 8080\n")
+		assert.NoError(t, os.Rename(configPath+".tmp", configPath))
+	}()
+	assert.NoError(t, config.LoadConfig(config))
+	assert.Equal(t, 8080, config.Server.Port)
+}
+
+func TestFingerprint(t *testing.T) {
+	config := &testAppConfig{App: newTestApp()}
+	config.Home = t.TempDir()
+	config.SystemConfigPaths = []string{}
+	assert.NoError(t, config.LoadConfig(config))
+
+	fingerprint, err := config.Fingerprint()
+	assert.NoError(t, err)
+	again, err := config.Fingerprint()
+	assert.NoError(t, err)
+	assert.Equal(t, fingerprint, again)
+
+	config.Server.Port = 9090
+	changed, err := config.Fingerprint()
+	assert.NoError(t, err)
+	assert.NotEqual(t, fingerprint, changed)
+
+	config.Version = "2.0.0"
+	upgraded, err := config.Fingerprint()
+	assert.NoError(t, err)
+	assert.NotEqual(t, changed, upgraded)
+}
+
+func TestLoadConfigFormats(t *testing.T) {
+	config := &testConfig{App: App{Name: "test", Home: t.TempDir(), SystemConfigPaths: []string{}}}
+	tomlConfig := writeTestFile(t, filepath.Join(config.Home, "config.toml"), "logLevel = \"debug\"\n[server]\nport = 8080\n")
+	assert.NoError(t, config.LoadConfig(config))
+	assert.Equal(t, 8080, config.Server.Port)
+	assert.Equal(t, "debug", config.LogLevel)
+	assert.Equal(t, "config.toml", config.ConfigSource("server.port"))
+
+	writeTestFile(t, filepath.Join(config.Home, "config.json"), `{"server": {"port": 9090}}`)
+	assert.Error(t, config.LoadConfig(config))
+
+	assert.NoError(t, os.Remove(tomlConfig))
+	assert.NoError(t, config.LoadConfig(config))
+	assert.Equal(t, 9090, config.Server.Port)
+}
+
+func TestConvertConfig(t *testing.T) {
+	config := &testConfig{App: App{Name: "test", Home: t.TempDir(), SystemConfigPaths: []string{}}}
+	writeTestFile(t, filepath.Join(config.Home, pathConfig), "logLevel: debug\nserver:\n  port: 8080\n")
+
+	assert.NoError(t, config.ConvertConfig(ConfigFormatTOML))
+	assert.FileExists(t, filepath.Join(config.Home, pathConfig+".bak"))
+	assert.NoFileExists(t, filepath.Join(config.Home, pathConfig))
+
+	assert.NoError(t, config.LoadConfig(config))
+	assert.Equal(t, 8080, config.Server.Port)
+	assert.Equal(t, "debug", config.LogLevel)
+	assert.Equal(t, "config.toml", config.ConfigSource("server.port"))
+}
+
+func TestConfigPathOverride(t *testing.T) {
+	config := &testConfig{App: App{Name: "test", Home: t.TempDir(), SystemConfigPaths: []string{}}}
+	writeTestFile(t, filepath.Join(config.Home, pathConfig), "server:\n  port: 80\n")
+	config.ConfigPath = writeTestFile(t, filepath.Join(t.TempDir(), "shared.yaml"), "server:\n  port: 8080\n")
+
+	assert.NoError(t, config.LoadConfig(config))
+	assert.Equal(t, 8080, config.Server.Port)
+
+	config.ConfigPath = t.TempDir()
+	assert.Error(t, config.LoadConfig(config))
+}
+
+type testEnvConfig struct {
+	*App
+	Server struct {
+		Host string `yaml:"host" env:"HOST"`
+		Port int    `yaml:"port" env:"PORT"`
+	} `yaml:"server"`
+	Debug   bool          `yaml:"debug" env:"DEBUG"`
+	Timeout time.Duration `yaml:"timeout" env:"TIMEOUT"`
+}
+
+func TestLoadEnvOverrides(t *testing.T) {
+	env := map[string]string{"MYAPP_PORT": "9090", "MYAPP_DEBUG": "true", "MYAPP_TIMEOUT": "3s"}
+	withHomeLookups(t, env, "/home/user", "/work")
+
+	config := &testEnvConfig{App: &App{Name: "myapp", Home: t.TempDir(), SystemConfigPaths: []string{}}}
+	writeTestFile(t, filepath.Join(config.Home, pathConfig), "server:\n  host: localhost\n  port: 80\n")
+	assert.NoError(t, config.LoadConfig(config))
+	assert.NoError(t, config.LoadEnvOverrides("MYAPP_"))
+
+	assert.Equal(t, "localhost", config.Server.Host)
+	assert.Equal(t, 9090, config.Server.Port)
+	assert.True(t, config.Debug)
+	assert.Equal(t, 3*time.Second, config.Timeout)
+	assert.Equal(t, "env:MYAPP_PORT", config.ConfigSource("server.port"))
+	assert.Equal(t, "env:MYAPP_DEBUG", config.ConfigSource("debug"))
+	assert.Equal(t, pathConfig, config.ConfigSource("server.host"))
+
+	env["MYAPP_PORT"] = "http"
+	assert.Error(t, config.LoadEnvOverrides("MYAPP_"))
+}
+
+type testValidatedConfig struct {
+	*App
+	Port int `yaml:"port"`
+}
+
+func (c *testValidatedConfig) Validate() error {
+	if c.Port <= 0 {
+		return errors.New("port must be positive")
+	}
+	return nil
+}
+
+func TestLoadConfigValidate(t *testing.T) {
+	config := &testValidatedConfig{App: &App{Name: "test", Home: t.TempDir(), SystemConfigPaths: []string{}}}
+	configPath := writeTestFile(t, filepath.Join(config.Home, pathConfig), "port: 0\n")
+	err := config.LoadConfig(config)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), configPath)
+
+	writeTestFile(t, configPath, "port: 80\n")
+	assert.NoError(t, config.LoadConfig(config))
+}
+
+func TestSaveConfig(t *testing.T) {
+	config := &testAppConfig{App: &App{Name: "test", Home: filepath.Join(t.TempDir(), "home"), SystemConfigPaths: []string{}}}
+	assert.NoError(t, config.LoadConfig(config))
+	config.Server.Host = "localhost"
+	config.Server.Port = 8080
+	assert.NoError(t, config.SaveConfig())
+
+	content, err := os.ReadFile(filepath.Join(config.Home, pathConfig))
+	assert.NoError(t, err)
+	assert.NotContains(t, string(content), "app")
+	info, err := os.Stat(filepath.Join(config.Home, pathConfig))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	assert.NoError(t, os.Chmod(filepath.Join(config.Home, pathConfig), 0640))
+
+	loaded := &testAppConfig{App: &App{Name: "test", Home: config.Home, SystemConfigPaths: []string{}}}
+	assert.NoError(t, loaded.LoadConfig(loaded))
+	assert.Equal(t, config.Server, loaded.Server)
+	assert.NoError(t, loaded.SaveConfig())
+	again, err := os.ReadFile(filepath.Join(config.Home, pathConfig))
+	assert.NoError(t, err)
+	assert.Equal(t, string(content), string(again))
+	info, err = os.Stat(filepath.Join(config.Home, pathConfig))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+
+	loaded.ReadOnlyConfig = true
+	assert.Equal(t, ErrConfigReadOnly, loaded.SaveConfig())
+}
+
+type testRoundTripConfig struct {
+	*App
+	Server   testConfigServer `yaml:"server"`
+	Runtime  string           `yaml:"-"`
+	Password secret           `yaml:"password"`
+}
+
+type secret struct {
+	value string
+}
+
+func TestVerifyConfigRoundTrip(t *testing.T) {
+	config := &testRoundTripConfig{App: &App{Name: "test"}, Runtime: "not saved"}
+	config.config = config
+	config.Server.Port = 8080
+	assert.NoError(t, config.VerifyConfigRoundTrip())
+
+	config.Password = secret{value: "lost"}
+	err := config.VerifyConfigRoundTrip()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "password")
+}
+
+func TestVerifyConfigChecksum(t *testing.T) {
+	config := &testAppConfig{App: &App{Name: "test", Home: t.TempDir(), SystemConfigPaths: []string{}, VerifyConfigChecksum: true}}
+	assert.NoError(t, config.LoadConfig(config))
+	config.Server.Port = 8080
+	assert.NoError(t, config.SaveConfig())
+	assert.NoError(t, config.LoadConfig(config))
+
+	writeTestFile(t, filepath.Join(config.Home, pathConfig), "server:\n  port: 9090\n")
+	assert.Equal(t, ErrConfigChecksumMismatch, config.LoadConfig(config))
+
+	assert.NoError(t, config.RefreshConfigChecksum())
+	assert.NoError(t, config.LoadConfig(config))
+	assert.Equal(t, 9090, config.Server.Port)
+}
+
+func TestConfigWritersKeepChecksum(t *testing.T) {
+	t.Setenv("EDITOR", "true")
+	config := &testConfig{App: App{Name: "test", Home: t.TempDir(), SystemConfigPaths: []string{}, VerifyConfigChecksum: true}}
+	assert.NoError(t, config.LoadConfig(config))
+	assert.NoError(t, config.EditConfig())
+	info, err := os.Stat(filepath.Join(config.Home, pathConfig))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	assert.NoError(t, config.LoadConfig(config))
+
+	assert.NoError(t, config.ConvertConfig(ConfigFormatJSON))
+	assert.NoFileExists(t, filepath.Join(config.Home, pathConfig+configChecksumSuffix))
+	assert.NoError(t, config.LoadConfig(config))
+}
+
+func TestDiffConfigFiles(t *testing.T) {
+	dir := t.TempDir()
+	current := writeTestFile(t, filepath.Join(dir, "current.yaml"), "logLevel: info\nserver:\n  host: localhost\n  port: 80\n")
+	proposed := writeTestFile(t, filepath.Join(dir, "proposed.toml"), "tags = [\"a\"]\n[server]\nhost = \"localhost\"\nport = 8080\n")
+
+	app := &App{Name: "test"}
+	changes, err := app.DiffConfigFiles(current, proposed)
+	assert.NoError(t, err)
+	assert.Equal(t, []ConfigChange{
+		{Key: "logLevel", Kind: ConfigChangeRemoved, Old: "info"},
+		{Key: "server.port", Kind: ConfigChangeModified, Old: 80, New: 8080},
+		{Key: "tags", Kind: ConfigChangeAdded, New: []any{"a"}},
+	}, changes)
+
+	_, err = app.DiffConfigFiles(current, filepath.Join(dir, "missing.yaml"))
+	assert.Error(t, err)
+}
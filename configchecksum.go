@@ -0,0 +1,62 @@
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"strings"
+
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+)
+
+// configChecksumSuffix names the sidecar holding the sha256 of the config file, written by SaveConfig
+const configChecksumSuffix = ".sha256"
+
+var ErrConfigChecksumMismatch = errs.With("Config file does not match its checksum, it was modified outside of SaveConfig")
+
+// RefreshConfigChecksum records the checksum of the config file as it is, accepting a manual edit
+func (app *App) RefreshConfigChecksum() error {
+	if app.ReadOnlyConfig {
+		return ErrConfigReadOnly
+	}
+	configFullPath, err := app.configPath()
+	if err != nil {
+		return err
+	}
+	content, err := os.ReadFile(configFullPath)
+	if err != nil {
+		return errs.WithEF(err, data.WithField("path", configFullPath), "Failed to read config file")
+	}
+	return writeConfigChecksum(configFullPath, content)
+}
+
+func writeConfigChecksum(configFullPath string, content []byte) error {
+	sum := sha256.Sum256(content)
+	checksumPath := configFullPath + configChecksumSuffix
+	if err := os.WriteFile(checksumPath, []byte(hex.EncodeToString(sum[:])+"\n"), 0600); err != nil {
+		return errs.WithEF(err, data.WithField("path", checksumPath), "Failed to write config checksum")
+	}
+	return nil
+}
+
+// verifyConfigChecksum fails with ErrConfigChecksumMismatch when the config file has no or another checksum
+func verifyConfigChecksum(configFullPath string) error {
+	content, err := os.ReadFile(configFullPath)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return errs.WithEF(err, data.WithField("path", configFullPath), "Failed to read config file")
+	}
+	expected, err := os.ReadFile(configFullPath + configChecksumSuffix)
+	if os.IsNotExist(err) {
+		return ErrConfigChecksumMismatch
+	} else if err != nil {
+		return errs.WithEF(err, data.WithField("path", configFullPath+configChecksumSuffix), "Failed to read config checksum")
+	}
+	sum := sha256.Sum256(content)
+	if strings.TrimSpace(string(expected)) != hex.EncodeToString(sum[:]) {
+		return ErrConfigChecksumMismatch
+	}
+	return nil
+}
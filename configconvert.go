@@ -0,0 +1,59 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+	"gopkg.in/yaml.v3"
+)
+
+// ConvertConfig rewrites the Home config file in another format. The previous file is kept
+// with a .bak suffix, since several config files in Home are refused
+func (app *App) ConvertConfig(toFormat string) error {
+	if app.ReadOnlyConfig {
+		return ErrConfigReadOnly
+	}
+	if !slices.Contains(defaultConfigFormats, toFormat) {
+		return errs.WithF(data.WithField("format", toFormat), "Unknown config format")
+	}
+
+	from, err := app.homeConfigPath()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(from); err != nil {
+		return errs.WithEF(err, data.WithField("path", from), "No config file to convert")
+	}
+	to := filepath.Join(app.Home, pathConfigName+"."+toFormat)
+	if to == from {
+		return nil
+	}
+
+	content, err := app.readConfigFile(from)
+	if err != nil {
+		return err
+	}
+	values := map[string]any{}
+	if err := yaml.Unmarshal(content, &values); err != nil {
+		return errs.WithEF(err, data.WithField("path", from), "Failed to parse config file")
+	}
+	converted, err := encodeConfig(toFormat, values)
+	if err != nil {
+		return err
+	}
+
+	if err := app.writeConfigFile(to, converted); err != nil {
+		return errs.WithEF(err, data.WithField("path", to), "Failed to write converted config file")
+	}
+	if err := os.Rename(from, from+".bak"); err != nil {
+		_ = os.Remove(to)
+		_ = os.Remove(to + configChecksumSuffix)
+		return errs.WithEF(err, data.WithField("path", from), "Failed to move previous config file away")
+	}
+	_ = os.Remove(from + configChecksumSuffix)
+	app.logger().Info(nil, data.WithField("from", from).WithField("to", to), "Converted config file")
+	return nil
+}
@@ -0,0 +1,167 @@
+package app
+
+import (
+	"reflect"
+	"sort"
+
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigDiff returns the dotted keys whose in memory value, possibly overridden at runtime,
+// differs from the config files, system layers and includes, with the in memory value
+func (app *App) ConfigDiff() (map[string]any, error) {
+	current, err := configValues(app.config)
+	if err != nil {
+		return nil, err
+	}
+
+	configFullPath, err := app.configPath()
+	if err != nil {
+		return nil, err
+	}
+	onDisk, err := app.loadConfigCandidate(configFullPath)
+	if err != nil {
+		return nil, err
+	}
+	persisted, err := configValues(onDisk)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := map[string]any{}
+	for key, value := range current {
+		if other, ok := persisted[key]; !ok || !reflect.DeepEqual(value, other) {
+			diff[key] = value
+		}
+	}
+	for key := range persisted {
+		if _, ok := current[key]; !ok {
+			diff[key] = nil
+		}
+	}
+	return diff, nil
+}
+
+type ConfigChangeKind string
+
+const (
+	ConfigChangeAdded    ConfigChangeKind = "added"
+	ConfigChangeRemoved  ConfigChangeKind = "removed"
+	ConfigChangeModified ConfigChangeKind = "modified"
+)
+
+// ConfigChange is a leaf config key that differs between two config files, Old or New being nil when absent
+type ConfigChange struct {
+	Key  string
+	Kind ConfigChangeKind
+	Old  any
+	New  any
+}
+
+// DiffConfigFiles returns the keys changed from config file a to config file b, sorted by key.
+// Each file is parsed according to its format, so a yaml file can be compared with a toml one
+func (app *App) DiffConfigFiles(a string, b string) ([]ConfigChange, error) {
+	old, err := app.configFileValues(a)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := app.configFileValues(b)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []ConfigChange
+	for key, value := range old {
+		if other, ok := updated[key]; !ok {
+			changes = append(changes, ConfigChange{Key: key, Kind: ConfigChangeRemoved, Old: value})
+		} else if !reflect.DeepEqual(value, other) {
+			changes = append(changes, ConfigChange{Key: key, Kind: ConfigChangeModified, Old: value, New: other})
+		}
+	}
+	for key, value := range updated {
+		if _, ok := old[key]; !ok {
+			changes = append(changes, ConfigChange{Key: key, Kind: ConfigChangeAdded, New: value})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Key < changes[j].Key
+	})
+	return changes, nil
+}
+
+// configFileValues returns the leaf values of a config file as dotted keys
+func (app *App) configFileValues(path string) (map[string]any, error) {
+	content, err := app.readConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var values map[string]any
+	if err := yaml.Unmarshal(content, &values); err != nil {
+		return nil, errs.WithEF(err, data.WithField("path", path), "Failed to parse config file")
+	}
+	leaves := map[string]any{}
+	for key, value := range flattenConfig(values) {
+		if _, ok := value.(map[string]any); !ok {
+			leaves[key] = value
+		}
+	}
+	return leaves, nil
+}
+
+// configValues returns the leaf values of a config as dotted keys
+func configValues(config any) (map[string]any, error) {
+	node, err := configNode(config)
+	if err != nil {
+		return nil, err
+	}
+	var values map[string]any
+	if err := node.Decode(&values); err != nil {
+		return nil, errs.WithE(err, "Failed to decode config")
+	}
+	leaves := map[string]any{}
+	for key, value := range flattenConfig(values) {
+		if _, ok := value.(map[string]any); !ok {
+			leaves[key] = value
+		}
+	}
+	return leaves, nil
+}
+
+// configNode encodes a config to a yaml node, without the fields of an embedded App
+func configNode(config any) (*yaml.Node, error) {
+	if config == nil {
+		return nil, errs.With("Config must be loaded before being used")
+	}
+	node := &yaml.Node{}
+	if err := node.Encode(config); err != nil {
+		return nil, errs.WithE(err, "Failed to encode config")
+	}
+
+	appKeys := map[string]bool{}
+	configType := reflect.TypeOf(config)
+	for configType.Kind() == reflect.Pointer {
+		configType = configType.Elem()
+	}
+	if configType.Kind() == reflect.Struct {
+		for i := 0; i < configType.NumField(); i++ {
+			field := configType.Field(i)
+			if isAppField(field) {
+				if name, inline, skip := yamlFieldName(field); !inline && !skip {
+					appKeys[name] = true
+				}
+			}
+		}
+	}
+	if node.Kind == yaml.MappingNode && len(appKeys) > 0 {
+		var content []*yaml.Node
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if !appKeys[node.Content[i].Value] {
+				content = append(content, node.Content[i], node.Content[i+1])
+			}
+		}
+		node.Content = content
+	}
+	return node, nil
+}
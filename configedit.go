@@ -0,0 +1,60 @@
+package app
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+)
+
+// EditConfig opens the config file in $EDITOR, writing the current config first if there is no file yet,
+// and loads it again once the editor exits, refreshing its checksum
+func (app *App) EditConfig() error {
+	if app.ReadOnlyConfig {
+		return ErrConfigReadOnly
+	}
+	if app.config == nil {
+		return errs.With("Config must be loaded before being edited")
+	}
+
+	configFullPath, err := app.configPath()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(configFullPath); os.IsNotExist(err) {
+		bytes, err := encodeConfig(configFormat(configFullPath), app.config)
+		if err != nil {
+			return errs.WithE(err, "Failed to marshal default config")
+		}
+		if err := app.writeConfigFile(configFullPath, bytes); err != nil {
+			return errs.WithEF(err, data.WithField("path", configFullPath), "Failed to write default config file")
+		}
+	}
+
+	editor := strings.Fields(os.Getenv("EDITOR"))
+	if len(editor) == 0 {
+		editor = []string{"vi"}
+		if runtime.GOOS == "windows" {
+			editor = []string{"notepad"}
+		}
+	}
+	cmd := exec.Command(editor[0], append(editor[1:], configFullPath)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return errs.WithEF(err, data.WithField("editor", editor[0]).WithField("path", configFullPath), "Failed to run config editor")
+	}
+	// editing through EditConfig is an accepted change
+	if err := app.RefreshConfigChecksum(); err != nil {
+		return err
+	}
+
+	if err := app.LoadConfig(app.config); err != nil {
+		return errs.WithEF(err, data.WithField("path", configFullPath), "Edited config is invalid, fix it and try again")
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package app
+
+import (
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+)
+
+// LoadEnvOverrides sets the config fields tagged `env:"NAME"` from the prefix+NAME environment variable when defined.
+// Call it after LoadConfig, so the environment overrides the config files.
+// Supports strings, bools, signed and unsigned integers, floats and durations, including in nested structs.
+// ConfigSource of an overridden key is "env:" followed by the variable name
+func (app *App) LoadEnvOverrides(prefix string) error {
+	var config any = app
+	if app.config != nil {
+		config = app.config
+	}
+	value := reflect.ValueOf(config)
+	if value.Kind() != reflect.Pointer || value.IsNil() {
+		return errs.WithF(data.WithField("type", value.Type().String()), "Config must be a non nil pointer")
+	}
+	return app.loadEnvOverrides(value.Elem(), prefix, "")
+}
+
+func (app *App) loadEnvOverrides(value reflect.Value, prefix string, keyPrefix string) error {
+	for value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return nil
+	}
+
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if !field.IsExported() || isAppField(field) {
+			continue
+		}
+		key, inline, _ := yamlFieldName(field)
+		name, ok := field.Tag.Lookup("env")
+		if !ok {
+			nestedPrefix := keyPrefix + key + "."
+			if inline {
+				nestedPrefix = keyPrefix
+			}
+			if err := app.loadEnvOverrides(value.Field(i), prefix, nestedPrefix); err != nil {
+				return err
+			}
+			continue
+		}
+		env, ok := lookupEnv(prefix + name)
+		if !ok {
+			continue
+		}
+		if err := setFromEnv(value.Field(i), env); err != nil {
+			return errs.WithEF(err, data.WithField("env", prefix+name).WithField("value", env).WithField("field", field.Name), "Invalid environment override")
+		}
+		if app.configSources == nil {
+			app.configSources = map[string]string{}
+		}
+		app.configSources[keyPrefix+key] = "env:" + prefix + name
+	}
+	return nil
+}
+
+func setFromEnv(field reflect.Value, env string) error {
+	if field.Type() == reflect.TypeOf(time.Duration(0)) {
+		duration, err := time.ParseDuration(env)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(duration))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(env)
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(env)
+		if err != nil {
+			return err
+		}
+		field.SetBool(parsed)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		parsed, err := strconv.ParseInt(env, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(parsed)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		parsed, err := strconv.ParseUint(env, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(parsed)
+	case reflect.Float32, reflect.Float64:
+		parsed, err := strconv.ParseFloat(env, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetFloat(parsed)
+	default:
+		return errs.WithF(data.WithField("kind", field.Kind().String()), "Unsupported field type for environment override")
+	}
+	return nil
+}
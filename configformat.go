@@ -0,0 +1,95 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	ConfigFormatYAML = "yaml"
+	ConfigFormatJSON = "json"
+	ConfigFormatTOML = "toml"
+)
+
+// pathConfigName is the config file name in Home, without its format extension
+const pathConfigName = "config"
+
+var defaultConfigFormats = []string{ConfigFormatYAML, ConfigFormatJSON, ConfigFormatTOML}
+
+func (app *App) configFormats() []string {
+	if len(app.ConfigFormats) > 0 {
+		return app.ConfigFormats
+	}
+	return defaultConfigFormats
+}
+
+// configFormat returns the format of a config file from its extension, yaml when unknown
+func configFormat(path string) string {
+	switch strings.ToLower(strings.TrimPrefix(filepath.Ext(path), ".")) {
+	case ConfigFormatJSON:
+		return ConfigFormatJSON
+	case ConfigFormatTOML:
+		return ConfigFormatTOML
+	default:
+		return ConfigFormatYAML
+	}
+}
+
+// configToYAML converts a config file content to yaml, so every format is decoded with the yaml tags of the config.
+// JSON is already valid yaml
+func configToYAML(format string, content []byte) ([]byte, error) {
+	if format != ConfigFormatTOML {
+		return content, nil
+	}
+	values := map[string]any{}
+	if err := toml.Unmarshal(content, &values); err != nil {
+		return nil, errs.WithE(err, "Failed to parse toml config")
+	}
+	converted, err := yaml.Marshal(values)
+	if err != nil {
+		return nil, errs.WithE(err, "Failed to convert toml config")
+	}
+	return converted, nil
+}
+
+// encodeConfig serializes a config, without the fields of an embedded App, in a config format
+func encodeConfig(format string, config any) ([]byte, error) {
+	node, err := configNode(config)
+	if err != nil {
+		return nil, err
+	}
+	if format == ConfigFormatYAML {
+		content, err := yaml.Marshal(node)
+		if err != nil {
+			return nil, errs.WithE(err, "Failed to encode config")
+		}
+		return content, nil
+	}
+
+	values := map[string]any{}
+	if err := node.Decode(&values); err != nil {
+		return nil, errs.WithE(err, "Failed to decode config")
+	}
+	switch format {
+	case ConfigFormatJSON:
+		content, err := json.MarshalIndent(values, "", "  ")
+		if err != nil {
+			return nil, errs.WithE(err, "Failed to encode json config")
+		}
+		return append(content, '\n'), nil
+	case ConfigFormatTOML:
+		buffer := &bytes.Buffer{}
+		if err := toml.NewEncoder(buffer).Encode(values); err != nil {
+			return nil, errs.WithE(err, "Failed to encode toml config")
+		}
+		return buffer.Bytes(), nil
+	}
+	return nil, errs.WithF(data.WithField("format", format), "Unknown config format")
+}
@@ -0,0 +1,75 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+	"gopkg.in/yaml.v3"
+)
+
+const configIncludeKey = "include"
+
+// splitConfigIncludes returns the files listed by the top level include key of a yaml config,
+// and the config without this key
+func splitConfigIncludes(content []byte) ([]string, []byte, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(content, &document); err != nil {
+		return nil, nil, err
+	}
+	if len(document.Content) == 0 || document.Content[0].Kind != yaml.MappingNode {
+		return nil, content, nil
+	}
+
+	root := document.Content[0]
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value != configIncludeKey {
+			continue
+		}
+		var includes []string
+		if err := root.Content[i+1].Decode(&includes); err != nil {
+			return nil, nil, errs.WithE(err, "Config include must be a list of paths")
+		}
+		root.Content = append(root.Content[:i], root.Content[i+2:]...)
+		rest, err := yaml.Marshal(&document)
+		if err != nil {
+			return nil, nil, err
+		}
+		return includes, rest, nil
+	}
+	return nil, content, nil
+}
+
+// loadConfigIncludes loads the files included by a config file, relative to its directory, in order
+func (app *App) loadConfigIncludes(configFullPath string, includes []string, self any, visited map[string]bool) error {
+	if len(includes) == 0 {
+		return nil
+	}
+	current, err := filepath.Abs(configFullPath)
+	if err != nil {
+		return errs.WithEF(err, data.WithField("path", configFullPath), "Failed to resolve config file path")
+	}
+	if visited == nil {
+		visited = map[string]bool{}
+	}
+	visited[current] = true
+	defer delete(visited, current)
+
+	for _, include := range includes {
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(filepath.Dir(current), include)
+		}
+		include = filepath.Clean(include)
+		if visited[include] {
+			return errs.WithF(data.WithField("path", configFullPath).WithField("include", include), "Config include cycle detected")
+		}
+		if _, err := os.Stat(include); err != nil {
+			return errs.WithEF(err, data.WithField("path", configFullPath).WithField("include", include), "Failed to find included config file")
+		}
+		if err := app.loadConfigFile(include, include, self, visited); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package app
+
+import (
+	"encoding"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	appType             = reflect.TypeOf(App{})
+	yamlUnmarshalerType = reflect.TypeOf((*yaml.Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// ConfigKeys returns every settable config key, as dotted yaml paths for nested structs
+func (app *App) ConfigKeys() []string {
+	if app.config == nil {
+		return nil
+	}
+	var keys []string
+	walkConfigType(reflect.TypeOf(app.config), "", func(key string, _ reflect.StructField) {
+		keys = append(keys, key)
+	})
+	sort.Strings(keys)
+	return keys
+}
+
+// walkConfigType calls fn for every leaf field of a config struct type with its dotted yaml key
+func walkConfigType(t reflect.Type, prefix string, fn func(key string, field reflect.StructField)) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if (!field.IsExported() && !field.Anonymous) || isAppField(field) {
+			continue
+		}
+		name, inline, skip := yamlFieldName(field)
+		if skip {
+			continue
+		}
+		if inline {
+			walkConfigType(field.Type, prefix, fn)
+			continue
+		}
+		if isConfigSection(field.Type) {
+			walkConfigType(field.Type, prefix+name+".", fn)
+			continue
+		}
+		fn(prefix+name, field)
+	}
+}
+
+func isAppField(field reflect.StructField) bool {
+	return field.Type == appType || field.Type == reflect.PointerTo(appType)
+}
+
+func yamlFieldName(field reflect.StructField) (name string, inline bool, skip bool) {
+	tag := field.Tag.Get("yaml")
+	if tag == "-" {
+		return "", false, true
+	}
+	parts := strings.Split(tag, ",")
+	for _, flag := range parts[1:] {
+		if flag == "inline" {
+			return "", true, false
+		}
+	}
+	if parts[0] != "" {
+		return parts[0], false, false
+	}
+	return strings.ToLower(field.Name), false, false
+}
+
+// isConfigSection reports whether a field type is a nested struct whose fields are keys themselves
+func isConfigSection(t reflect.Type) bool {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+	pointer := reflect.PointerTo(t)
+	return !pointer.Implements(yamlUnmarshalerType) && !pointer.Implements(textUnmarshalerType)
+}
@@ -0,0 +1,70 @@
+package app
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testConfigServer struct {
+	Host string `yaml:"host"`
+	Port int    `yaml:"port,omitempty"`
+}
+
+type testConfigCommon struct {
+	LogLevel string `yaml:"logLevel"`
+}
+
+type testConfig struct {
+	App              `yaml:"-"`
+	testConfigCommon `yaml:",inline"`
+	Server           testConfigServer  `yaml:"server"`
+	Backup           *testConfigServer `yaml:"backup"`
+	Timeout          time.Duration
+	Tags             []string `yaml:"tags"`
+	Ignored          string   `yaml:"-"`
+	private          string
+}
+
+func TestConfigKeys(t *testing.T) {
+	config := &testConfig{}
+	config.config = config
+
+	assert.Equal(t, []string{
+		"backup.host",
+		"backup.port",
+		"logLevel",
+		"server.host",
+		"server.port",
+		"tags",
+		"timeout",
+	}, config.ConfigKeys())
+}
+
+func TestApplySetOverrides(t *testing.T) {
+	config := &testConfig{}
+	config.config = config
+	config.Tags = []string{"old"}
+
+	assert.NoError(t, config.ApplySetOverrides([]string{
+		"server.port=8080",
+		"backup.host=backup.local",
+		"logLevel=debug",
+		"timeout=3s",
+		"tags=[a, b]",
+	}))
+	assert.Equal(t, 8080, config.Server.Port)
+	assert.Equal(t, "backup.local", config.Backup.Host)
+	assert.Equal(t, "debug", config.LogLevel)
+	assert.Equal(t, 3*time.Second, config.Timeout)
+	assert.Equal(t, []string{"a", "b"}, config.Tags)
+	assert.Equal(t, configSourceSet, config.ConfigSource("server.port"))
+
+	err := config.ApplySetOverrides([]string{"server.port=http"})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "server.port=http")
+	assert.Error(t, config.ApplySetOverrides([]string{"server.prt=80"}))
+	assert.Error(t, config.ApplySetOverrides([]string{"server.port"}))
+	assert.Error(t, config.ApplySetOverrides([]string{"ignored=x"}))
+}
@@ -0,0 +1,77 @@
+package app
+
+import (
+	"reflect"
+	"sort"
+
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+	"gopkg.in/yaml.v3"
+)
+
+// VerifyConfigRoundTrip checks the loaded config is the same once saved and loaded again,
+// reporting the fields SaveConfig would drop or mangle. Fields tagged yaml:"-" are not checked
+func (app *App) VerifyConfigRoundTrip() error {
+	node, err := configNode(app.config)
+	if err != nil {
+		return err
+	}
+	content, err := yaml.Marshal(node)
+	if err != nil {
+		return errs.WithE(err, "Failed to encode config")
+	}
+	reloaded, err := app.newConfig()
+	if err != nil {
+		return err
+	}
+	if err := yaml.Unmarshal(content, reloaded); err != nil {
+		return errs.WithEF(err, data.WithField("content", string(content)), "Failed to parse encoded config")
+	}
+
+	var diffs []string
+	compareConfigValue("", reflect.ValueOf(app.config), reflect.ValueOf(reloaded), &diffs)
+	if len(diffs) > 0 {
+		sort.Strings(diffs)
+		return errs.WithF(data.WithField("fields", diffs), "Config does not round trip")
+	}
+	return nil
+}
+
+func compareConfigValue(path string, a reflect.Value, b reflect.Value, diffs *[]string) {
+	for a.Kind() == reflect.Pointer && b.Kind() == reflect.Pointer && !a.IsNil() && !b.IsNil() {
+		a, b = a.Elem(), b.Elem()
+	}
+
+	switch {
+	case a.Kind() == reflect.Struct && a.Type() == b.Type() && isConfigSection(a.Type()) && hasExportedField(a.Type()):
+		for i := 0; i < a.NumField(); i++ {
+			field := a.Type().Field(i)
+			if !field.IsExported() || isAppField(field) {
+				continue
+			}
+			name, inline, skip := yamlFieldName(field)
+			if skip {
+				continue
+			}
+			fieldPath := path
+			if !inline && path != "" {
+				fieldPath = path + "." + name
+			} else if !inline {
+				fieldPath = name
+			}
+			compareConfigValue(fieldPath, a.Field(i), b.Field(i), diffs)
+		}
+	case (a.Kind() == reflect.Slice || a.Kind() == reflect.Map) && a.Len() == 0 && b.Len() == 0:
+	case !reflect.DeepEqual(a.Interface(), b.Interface()):
+		*diffs = append(*diffs, path)
+	}
+}
+
+func hasExportedField(t reflect.Type) bool {
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).IsExported() {
+			return true
+		}
+	}
+	return false
+}
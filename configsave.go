@@ -0,0 +1,67 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+)
+
+// SaveConfig writes the loaded config, without the fields of an embedded App, to the config file in its format.
+// The file is replaced atomically through a temp file in the same directory, keeping the mode and, when possible,
+// the ownership of the previous file. A new file is only readable by its owner.
+// The sha256 of the file is written next to it, for VerifyConfigChecksum
+func (app *App) SaveConfig() error {
+	if app.ReadOnlyConfig {
+		return ErrConfigReadOnly
+	}
+	if app.config == nil {
+		return errs.With("Config must be loaded before being saved")
+	}
+
+	configFullPath, err := app.configPath()
+	if err != nil {
+		return err
+	}
+	content, err := encodeConfig(configFormat(configFullPath), app.config)
+	if err != nil {
+		return err
+	}
+
+	return app.writeConfigFile(configFullPath, content)
+}
+
+// writeConfigFile replaces a config file atomically with content, and writes its checksum
+func (app *App) writeConfigFile(configFullPath string, content []byte) error {
+	if err := os.MkdirAll(filepath.Dir(configFullPath), 0755); err != nil {
+		return errs.WithEF(err, data.WithField("path", filepath.Dir(configFullPath)), "Failed to create config directory")
+	}
+	mode := os.FileMode(0600)
+	previous, err := os.Stat(configFullPath)
+	if err == nil {
+		mode = previous.Mode().Perm()
+	}
+
+	tmp := configFullPath + ".tmp-" + strconv.Itoa(os.Getpid())
+	if err := os.WriteFile(tmp, content, mode); err != nil {
+		_ = os.Remove(tmp)
+		return errs.WithEF(err, data.WithField("path", tmp), "Failed to write config file")
+	}
+	// the mode given on creation is reduced by umask
+	if err := os.Chmod(tmp, mode); err != nil {
+		_ = os.Remove(tmp)
+		return errs.WithEF(err, data.WithField("path", tmp), "Failed to set config file mode")
+	}
+	if previous != nil {
+		if err := copyOwnership(tmp, previous); err != nil {
+			app.logger().Warn(err, nil, "Failed to keep config file ownership")
+		}
+	}
+	if err := os.Rename(tmp, configFullPath); err != nil {
+		_ = os.Remove(tmp)
+		return errs.WithEF(err, data.WithField("path", configFullPath), "Failed to replace config file")
+	}
+	return writeConfigChecksum(configFullPath, content)
+}
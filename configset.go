@@ -0,0 +1,110 @@
+package app
+
+import (
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+	"gopkg.in/yaml.v3"
+)
+
+const configSourceSet = "set"
+
+// ApplySetOverrides applies dotted.key=value pairs, like those of --set flags, onto the loaded config.
+// Call it last, after LoadConfig and LoadEnvOverrides, as they take precedence over both.
+// Values are coerced to the type of their field, parsed as yaml for lists, maps and unmarshalers
+func (app *App) ApplySetOverrides(pairs []string) error {
+	if app.config == nil {
+		return errs.With("Config must be loaded before applying overrides")
+	}
+	config := reflect.ValueOf(app.config)
+	if config.Kind() != reflect.Pointer || config.IsNil() {
+		return errs.WithF(data.WithField("type", config.Type().String()), "Config must be a non nil pointer")
+	}
+
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return errs.WithF(data.WithField("pair", pair), "Invalid config override, expected key=value")
+		}
+		field, ok := configField(config.Elem(), key)
+		if !ok {
+			return errs.WithF(data.WithField("pair", pair).WithField("key", key), "Unknown config key")
+		}
+		if err := setFromOverride(field, value); err != nil {
+			return errs.WithEF(err, data.WithField("pair", pair).WithField("type", field.Type().String()), "Invalid config override value")
+		}
+		if app.configSources == nil {
+			app.configSources = map[string]string{}
+		}
+		app.configSources[key] = configSourceSet
+	}
+	return nil
+}
+
+// configField returns the settable field of a dotted config key, allocating nil sections on the way
+func configField(value reflect.Value, key string) (reflect.Value, bool) {
+	for value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			value.Set(reflect.New(value.Type().Elem()))
+		}
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return reflect.Value{}, false
+	}
+
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if (!field.IsExported() && !field.Anonymous) || isAppField(field) {
+			continue
+		}
+		name, inline, skip := yamlFieldName(field)
+		if skip {
+			continue
+		}
+		if inline {
+			if found, ok := configField(value.Field(i), key); ok {
+				return found, true
+			}
+			continue
+		}
+		if isConfigSection(field.Type) {
+			if rest, ok := strings.CutPrefix(key, name+"."); ok {
+				return configField(value.Field(i), rest)
+			}
+			continue
+		}
+		if name == key && value.Field(i).CanSet() {
+			return value.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+func setFromOverride(field reflect.Value, value string) error {
+	if field.Type() == reflect.TypeOf(time.Duration(0)) {
+		return setFromEnv(field, value)
+	}
+	pointer := reflect.PointerTo(field.Type())
+	if pointer.Implements(yamlUnmarshalerType) || pointer.Implements(textUnmarshalerType) {
+		return yaml.Unmarshal([]byte(value), field.Addr().Interface())
+	}
+	switch field.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return setFromEnv(field, value)
+	}
+	// a fresh value, so a list replaces the previous one instead of being merged into it
+	parsed := reflect.New(field.Type())
+	if err := yaml.Unmarshal([]byte(value), parsed.Interface()); err != nil {
+		return err
+	}
+	field.Set(parsed.Elem())
+	return nil
+}
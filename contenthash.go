@@ -0,0 +1,61 @@
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"sync"
+
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+)
+
+type embeddedContentHash struct {
+	once sync.Once
+	sum  string
+	err  error
+}
+
+// EmbeddedContentHash returns a sha256 of the embedded paths and contents, computed once per App and embedded
+func (app *App) EmbeddedContentHash() (string, error) {
+	if app.Embedded == nil {
+		return "", errs.With("App has no embedded")
+	}
+
+	app.embeddedMutex.Lock()
+	if app.contentHash == nil {
+		app.contentHash = &embeddedContentHash{}
+	}
+	contentHash := app.contentHash
+	app.embeddedMutex.Unlock()
+
+	contentHash.once.Do(func() {
+		contentHash.sum, contentHash.err = app.computeEmbeddedContentHash()
+	})
+	return contentHash.sum, contentHash.err
+}
+
+func (app *App) computeEmbeddedContentHash() (string, error) {
+	entries, err := app.embeddedEntries()
+	if err != nil {
+		return "", errs.WithE(err, "Failed to list embedded")
+	}
+	hash := sha256.New()
+	for _, entry := range entries {
+		if !entry.regular || entry.path == pathEmbeddedManifest {
+			continue
+		}
+		file, err := app.embeddedFS().Open(entry.path)
+		if err != nil {
+			return "", errs.WithEF(err, data.WithField("path", entry.path), "Failed to open embedded file")
+		}
+		fileHash := sha256.New()
+		_, err = io.Copy(fileHash, file)
+		file.Close()
+		if err != nil {
+			return "", errs.WithEF(err, data.WithField("path", entry.path), "Failed to read embedded file")
+		}
+		io.WriteString(hash, entry.path+"\x00"+hex.EncodeToString(fileHash.Sum(nil))+"\n")
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,49 @@
+package app
+
+import (
+	"context"
+	"time"
+
+	"github.com/n0rad/go-erlog/data"
+)
+
+// InitResult describes what an Init did and how far it went
+type InitResult struct {
+	// FirstRun is set when no version was recorded in Home, PreviousVersion holding the recorded one otherwise
+	FirstRun        bool
+	PreviousVersion string
+	// Extracted is set when embedded was extracted, FileCount being the number of files written or kept
+	Extracted bool
+	FileCount int
+	// CleanedVersions are the embedded versions removed by cleanup
+	CleanedVersions []string
+	// ExtractionComplete is false when the extraction was stopped, it is done again, or resumed
+	// with ResumableExtract, by the next Init
+	ExtractionComplete bool
+	Duration           time.Duration
+}
+
+// InitWithDeadline runs Init, stopping the extraction when the deadline is reached. The version is then not recorded
+// in Home and the result reports the incomplete extraction, with the lock released
+func (app *App) InitWithDeadline(home string, self any, deadline time.Time) (*InitResult, error) {
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+
+	state, err := app.initHome(ctx, home, self)
+	if err != nil {
+		return nil, err
+	}
+	defer state.release(app.logger())
+
+	if err := app.initEmbedded(state); err != nil {
+		if ctx.Err() == nil {
+			return nil, err
+		}
+		app.logger().Warn(err, data.WithField("deadline", deadline), "Init deadline reached before extraction completed")
+		state.result.Duration = time.Since(state.start)
+		return &state.result, nil
+	}
+	state.result.ExtractionComplete = true
+	state.result.Duration = time.Since(state.start)
+	return &state.result, nil
+}
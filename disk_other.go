@@ -0,0 +1,11 @@
+//go:build !linux && !darwin
+
+package app
+
+func freeInodes(path string) (free uint64, ok bool, err error) {
+	return 0, false, nil
+}
+
+func freeBytes(path string) (free uint64, ok bool, err error) {
+	return 0, false, nil
+}
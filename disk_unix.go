@@ -0,0 +1,27 @@
+//go:build linux || darwin
+
+package app
+
+import "syscall"
+
+// freeInodes returns the number of free inodes on the filesystem holding path, ok is false when unknown
+func freeInodes(path string) (free uint64, ok bool, err error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, false, err
+	}
+	if stat.Files == 0 {
+		// filesystems allocating inodes dynamically (btrfs...) report no total
+		return 0, false, nil
+	}
+	return uint64(stat.Ffree), true, nil
+}
+
+// freeBytes returns the space available to unprivileged users on the filesystem holding path
+func freeBytes(path string) (free uint64, ok bool, err error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, false, err
+	}
+	return uint64(stat.Bavail) * uint64(stat.Bsize), true, nil
+}
@@ -0,0 +1,116 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/gofrs/flock"
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+)
+
+// InitPlan is what Init would do, as computed by PlanInit
+type InitPlan struct {
+	Home        string
+	CreateHome  bool
+	Version     string
+	HomeVersion string
+	// Extract is set when embedded would be extracted to EmbeddedPath, for Reason
+	Extract      bool
+	Reason       string
+	EmbeddedPath string
+	// CleanupVersions are the extracted embedded versions cleanup would remove
+	CleanupVersions []string
+}
+
+// PlanInit runs the detections of Init, including loading the config, and returns what Init would do
+// without writing or removing anything. The home lock is only held shared, when it already exists
+func (app *App) PlanInit(home string, self any) (*InitPlan, error) {
+	app.Version = strings.TrimSpace(app.Version)
+	if err := app.validateVersion(); err != nil {
+		return nil, err
+	}
+	if err := app.checkMinVersion(); err != nil {
+		return nil, err
+	}
+	resolved, err := app.resolveHome(home)
+	if err != nil {
+		return nil, err
+	}
+	app.Home = resolved
+	plan := &InitPlan{Home: app.Home, Version: app.Version}
+
+	if _, err := os.Stat(app.Home); os.IsNotExist(err) {
+		plan.CreateHome = true
+	} else if err != nil {
+		return nil, errs.WithEF(err, data.WithField("path", app.Home), "Failed to read "+app.Name+" home directory")
+	} else {
+		if err := app.verifyHomeRoot(); err != nil {
+			return nil, err
+		}
+		if app.VerifyHomeOwnership {
+			if err := verifyOwnership(app.Home); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	lockPath := filepath.Join(app.Home, pathLock)
+	if _, err := os.Stat(lockPath); err == nil {
+		lock := flock.New(lockPath)
+		if err := lock.RLock(); err != nil {
+			return nil, errs.WithE(err, "Failed to get shared home lock")
+		}
+		defer lock.Unlock()
+	}
+
+	homeVersion, homeVersionErr := app.readHomeVersion()
+	if homeVersionErr != nil && !os.IsNotExist(homeVersionErr) {
+		if err := app.warnOrFail(homeVersionErr, "Failed to read home version"); err != nil {
+			return nil, err
+		}
+	}
+	plan.HomeVersion = homeVersion
+
+	if err := app.LoadConfig(self); err != nil {
+		return nil, err
+	}
+
+	if app.Embedded == nil {
+		return plan, nil
+	}
+	if err := app.checkEmbeddedRoots(); err != nil {
+		return nil, err
+	}
+	app.EmbeddedPath = app.planEmbeddedPath()
+	plan.EmbeddedPath = app.EmbeddedPath
+	plan.Reason = app.extractionReason(homeVersion, homeVersionErr)
+	plan.Extract = plan.Reason != ""
+
+	var embeddedVersions []string
+	if _, err := os.Stat(filepath.Join(app.cacheHome(), pathEmbedded)); err == nil {
+		if embeddedVersions, err = app.EmbeddedVersions(); err != nil {
+			return nil, err
+		}
+	}
+	if plan.Extract && !slices.Contains(embeddedVersions, app.Version) {
+		embeddedVersions = append(embeddedVersions, app.Version)
+	}
+	if plan.CleanupVersions, err = app.retentionToRemove(filepath.Join(app.cacheHome(), pathEmbedded), embeddedVersions); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+func (p *InitPlan) log(logger Logger) {
+	logger.Info(nil, data.WithField("home", p.Home).
+		WithField("createHome", p.CreateHome).
+		WithField("version", p.Version).
+		WithField("homeVersion", p.HomeVersion).
+		WithField("extract", p.Extract).
+		WithField("reason", p.Reason).
+		WithField("embeddedPath", p.EmbeddedPath).
+		WithField("cleanup", p.CleanupVersions), "Dry run, nothing changed")
+}
@@ -0,0 +1,29 @@
+package app
+
+// EventHandler receives the lifecycle events of Init, from the goroutine running it.
+// Embed NopEventHandler to only implement some of them
+type EventHandler interface {
+	// OnHomeReady is called once Home exists and is locked, before the config is loaded
+	OnHomeReady(home string)
+	OnConfigLoaded(path string)
+	OnExtractStart(embeddedPath string)
+	// OnExtractFinish receives the number of files extracted, and the error failing Init if any
+	OnExtractFinish(embeddedPath string, files int, err error)
+	// OnCleanupDone receives the embedded versions removed, and the error that stopped cleanup if any
+	OnCleanupDone(removed []string, err error)
+}
+
+// NopEventHandler ignores every event
+type NopEventHandler struct{}
+
+func (NopEventHandler) OnHomeReady(home string)                                   {}
+func (NopEventHandler) OnConfigLoaded(path string)                                {}
+func (NopEventHandler) OnExtractStart(embeddedPath string)                        {}
+func (NopEventHandler) OnExtractFinish(embeddedPath string, files int, err error) {}
+func (NopEventHandler) OnCleanupDone(removed []string, err error)                 {}
+
+func (app *App) emit(event func(handler EventHandler)) {
+	for _, handler := range app.Handlers {
+		event(handler)
+	}
+}
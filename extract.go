@@ -0,0 +1,634 @@
+package app
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+)
+
+// pathEmbeddedManifest is an optional build time manifest at the root of the embedded FS, never extracted
+const pathEmbeddedManifest = ".manifest.json"
+
+// controlFile tells whether an embedded path is one of the control files at the root of the embedded FS,
+// which are never extracted, counted nor archived
+func controlFile(path string) bool {
+	return path == pathEmbeddedManifest || path == pathEmbeddedIgnore || path == pathEmbeddedSymlinks
+}
+
+type extraction struct {
+	ctx    context.Context
+	target string
+	// final is set when extracting to a staging target, renamed to final once complete
+	final    string
+	manifest Manifest
+	journal  *extractJournal
+	mtimes   Manifest
+	verify   Manifest
+	// modes is the embedded manifest, whose modes are applied as embed reports every file as 0444
+	modes Manifest
+	// previous is the manifest of an extracted tree at previousRoot, whose identical files are hard linked
+	previous     Manifest
+	previousRoot string
+
+	verifyArch  bool
+	readOnly    bool
+	maxFileSize int64
+	provenance  *provenance
+
+	home   string
+	routes []ExtractRoute
+	// routed maps each routed file to the embedded path extracted to it
+	routed map[string]string
+
+	localeDir string
+	locales   []string
+
+	channel          string
+	conditionalSkips []string
+	ignore           ignoreRules
+	symlinks         map[string]string
+
+	progress extractProgress
+
+	priority     []string
+	priorityDone bool
+
+	entries []embeddedEntry
+
+	// concurrency is how many files are extracted at once, mutex guarding what they record
+	concurrency int
+	mutex       sync.Mutex
+}
+
+func (e *extraction) isPriority(path string) bool {
+	return matchesAny(e.priority, filepath.ToSlash(path))
+}
+
+// stage makes the extraction write to a temp sibling of final, only moved to final by commit
+func (e *extraction) stage(final string) {
+	e.final = final
+	e.target = final + ".tmp-" + strconv.Itoa(os.Getpid())
+}
+
+// commit moves a complete staged extraction into place
+func (e *extraction) commit() error {
+	if e.final == "" {
+		return nil
+	}
+	if err := removeTree(e.final); err != nil {
+		return errs.WithEF(err, data.WithField("path", e.final), "Failed to remove previous embedded")
+	}
+	if err := os.Rename(e.target, e.final); err != nil {
+		return errs.WithEF(err, data.WithField("path", e.target).WithField("final", e.final), "Failed to move extracted embedded into place")
+	}
+	return nil
+}
+
+// abort removes what a failed staged extraction wrote
+func (e *extraction) abort(logger Logger) {
+	if e.final == "" {
+		return
+	}
+	if err := removeTree(e.target); err != nil {
+		logger.Warn(err, data.WithField("path", e.target), "Failed to remove staging embedded")
+	}
+}
+
+// restart prepares the extraction to run again from scratch into another target
+func (e *extraction) restart(target string) {
+	if e.final != "" {
+		e.stage(target)
+	} else {
+		e.target = target
+	}
+	e.priorityDone = false
+	e.progress.done = 0
+	e.routed = nil
+	if e.manifest != nil {
+		e.manifest = Manifest{}
+	}
+}
+
+func (e *extraction) close() {
+	if e.journal != nil {
+		e.journal.Close()
+	}
+}
+
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// extractEmbedded extracts priority files first, then the others, then creates symlinks
+func (app *App) extractEmbedded(e *extraction) error {
+	if err := app.extractEmbeddedFiles(e); err != nil {
+		return err
+	}
+	symlinks, err := app.readEmbeddedSymlinks()
+	if err != nil {
+		return err
+	}
+	e.symlinks = symlinks
+	return e.createSymlinks()
+}
+
+// embeddedFS returns the embedded FS rooted at EmbeddedPrefix, checked by checkEmbeddedRoots
+func (app *App) embeddedFS() fs.FS {
+	if app.EmbeddedPrefix == "" {
+		return app.Embedded
+	}
+	sub, err := fs.Sub(app.Embedded, strings.Trim(app.EmbeddedPrefix, "/"))
+	if err != nil {
+		return app.Embedded
+	}
+	return sub
+}
+
+// checkEmbeddedRoots fails when EmbeddedPrefix or EmbeddedChannel are not embedded directories
+func (app *App) checkEmbeddedRoots() error {
+	if app.EmbeddedPrefix != "" {
+		prefix := strings.Trim(app.EmbeddedPrefix, "/")
+		if !fs.ValidPath(prefix) {
+			return errs.WithF(data.WithField("prefix", app.EmbeddedPrefix), "Invalid embedded prefix")
+		}
+		if stat, err := fs.Stat(app.Embedded, prefix); err != nil || !stat.IsDir() {
+			return errs.WithEF(err, data.WithField("prefix", app.EmbeddedPrefix), "Embedded prefix does not exist")
+		}
+	}
+	if app.EmbeddedChannel != "" {
+		if stat, err := fs.Stat(app.embeddedFS(), app.EmbeddedChannel); err != nil || !stat.IsDir() {
+			return errs.WithEF(err, data.WithField("channel", app.EmbeddedChannel), "Embedded channel does not exist")
+		}
+	}
+	return nil
+}
+
+// ExtractEmbeddedTo extracts embedded to target, created if needed, without Init nor anything recorded in Home.
+// Channel, locales, conditions and ignore rules apply, routes do not. It fails on a file already in target
+func (app *App) ExtractEmbeddedTo(target string) error {
+	if app.Embedded == nil {
+		return errs.With("App has no embedded to extract")
+	}
+	if err := app.checkEmbeddedRoots(); err != nil {
+		return err
+	}
+	e, err := app.newExtraction(nil, target)
+	if err != nil {
+		return err
+	}
+	e.routes = nil
+	e.manifest = nil
+	if err := os.MkdirAll(target, 0755); err != nil {
+		return errs.WithEF(err, data.WithField("path", target), "Failed to create extraction target")
+	}
+	if err := app.extractEmbedded(e); err != nil {
+		return errs.WithEF(err, data.WithField("path", target), "Failed to extract embedded")
+	}
+	return nil
+}
+
+// newExtraction returns an extraction to target configured from the App: channel, locales, conditions,
+// ignore rules, routes, limits and read only mode
+func (app *App) newExtraction(ctx context.Context, target string) (*extraction, error) {
+	if err := app.checkExtractRoutes(); err != nil {
+		return nil, err
+	}
+	ignore, err := app.readEmbeddedIgnore()
+	if err != nil {
+		return nil, err
+	}
+	e := &extraction{
+		ctx:         ctx,
+		target:      target,
+		manifest:    Manifest{},
+		verifyArch:  app.VerifyExecArch,
+		readOnly:    app.ReadOnlyExtract,
+		maxFileSize: app.MaxEmbeddedFileSize,
+		home:        app.Home,
+		routes:      app.ExtractRoutes,
+		concurrency: app.extractConcurrency(),
+
+		channel:          app.EmbeddedChannel,
+		conditionalSkips: app.conditionalSkips(),
+		ignore:           ignore,
+		progress:         extractProgress{writer: app.ExtractProgressWriter, callback: app.OnExtractProgress},
+	}
+	if app.EmbeddedLocaleDir != "" && len(app.Locales) > 0 {
+		e.localeDir = strings.Trim(app.EmbeddedLocaleDir, "/")
+		e.locales = app.Locales
+	}
+	return e, nil
+}
+
+func (app *App) extractEmbeddedFiles(e *extraction) error {
+	if len(e.priority) == 0 {
+		return app.extractEmbeddedPass(e, nil)
+	}
+	if !e.priorityDone {
+		if err := app.extractEmbeddedPass(e, e.isPriority); err != nil {
+			return err
+		}
+		e.priorityDone = true
+	}
+	return app.extractEmbeddedPass(e, func(path string) bool {
+		return !e.isPriority(path)
+	})
+}
+
+type embeddedEntry struct {
+	path    string
+	dir     bool
+	regular bool
+}
+
+// embeddedEntries returns every entry of the embedded FS, globally sorted by path
+// so extraction, and everything recorded while extracting, is deterministic
+func (app *App) embeddedEntries() ([]embeddedEntry, error) {
+	var entries []embeddedEntry
+	if err := fs.WalkDir(app.embeddedFS(), ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		entries = append(entries, embeddedEntry{path: path, dir: d.IsDir(), regular: d.Type().IsRegular()})
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].path < entries[j].path
+	})
+	return entries, nil
+}
+
+// channelPath returns an embedded path relative to the extraction target, false when outside of the channel
+func (e *extraction) channelPath(embeddedPath string) (string, bool) {
+	if e.channel == "" {
+		return embeddedPath, true
+	}
+	if embeddedPath == e.channel {
+		return ".", true
+	}
+	return strings.CutPrefix(embeddedPath, e.channel+"/")
+}
+
+// filePath returns where an embedded file is extracted
+func (e *extraction) filePath(embeddedPath string) (string, bool) {
+	if routedPath, ok := e.routedPath(embeddedPath); ok {
+		return routedPath, true
+	}
+	rel, ok := e.channelPath(embeddedPath)
+	if !ok {
+		return "", false
+	}
+	return filepath.Join(e.target, rel), true
+}
+
+// extractEmbeddedPass extracts files accepted by filter, or all files when nil
+func (app *App) extractEmbeddedPass(e *extraction, filter func(path string) bool) error {
+	if e.entries == nil {
+		entries, err := app.embeddedEntries()
+		if err != nil {
+			return err
+		}
+		e.entries = entries
+		if e.modes, err = app.readEmbeddedManifest(); err != nil {
+			return err
+		}
+	}
+
+	var jobs []extractJob
+	for _, entry := range e.entries {
+		if e.ctx != nil {
+			if err := e.ctx.Err(); err != nil {
+				return err
+			}
+		}
+		if e.excludedLocale(entry) || e.skippedConditional(entry.path) || e.skippedIgnored(entry) {
+			continue
+		}
+		targetPath, ok := e.channelPath(entry.path)
+		if !ok {
+			continue
+		}
+		newPath := filepath.Join(e.target, targetPath)
+		if entry.dir {
+			if err := os.MkdirAll(newPath, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if filter != nil && !filter(entry.path) {
+			continue
+		}
+
+		if !entry.regular {
+			return errs.WithF(data.WithField("path", entry.path), "Embedded is invalid, not a regular file")
+		}
+
+		if routedPath, ok := e.routedPath(entry.path); ok {
+			newPath = routedPath
+			if err := e.claimRoutedPath(entry.path, routedPath); err != nil {
+				return err
+			}
+			if err := os.MkdirAll(filepath.Dir(newPath), 0755); err != nil {
+				return err
+			}
+			// routed files are outside the embedded path which is not removed before extraction
+			if e.mtimes == nil && e.journal == nil {
+				if err := os.Remove(newPath); err != nil && !os.IsNotExist(err) {
+					return errs.WithEF(err, data.WithField("path", newPath), "Failed to remove previously routed file")
+				}
+			}
+		}
+
+		jobs = append(jobs, extractJob{path: entry.path, newPath: newPath})
+	}
+	return app.extractFiles(e, jobs)
+}
+
+type extractJob struct {
+	path    string
+	newPath string
+}
+
+// extractFiles extracts files once their directories exist, with up to e.concurrency workers
+// stopping at the first error
+func (app *App) extractFiles(e *extraction, jobs []extractJob) error {
+	ctx := e.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	workers := min(e.concurrency, len(jobs))
+	if workers <= 1 {
+		for _, job := range jobs {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := app.extractFile(e, job.path, job.newPath); err != nil {
+				return err
+			}
+			e.reportProgress(job.path)
+		}
+		return nil
+	}
+
+	workersCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var firstErr error
+	var failOnce sync.Once
+	queue := make(chan extractJob)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range queue {
+				if err := app.extractFile(e, job.path, job.newPath); err != nil {
+					failOnce.Do(func() {
+						firstErr = err
+						cancel()
+					})
+					continue
+				}
+				e.reportProgress(job.path)
+			}
+		}()
+	}
+feed:
+	for _, job := range jobs {
+		select {
+		case queue <- job:
+		case <-workersCtx.Done():
+			break feed
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+// recordExtracted adds an extracted file to the manifest and journal, safe for concurrent workers
+func (e *extraction) recordExtracted(path string, entry ManifestEntry, journal bool) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.manifest != nil {
+		e.manifest[filepath.ToSlash(path)] = entry
+	}
+	if journal && e.journal != nil {
+		return e.journal.record(path, entry)
+	}
+	return nil
+}
+
+func (app *App) extractFile(e *extraction, path string, newPath string) error {
+	if controlFile(path) {
+		return nil
+	}
+
+	if e.mtimes != nil {
+		if entry, ok := e.mtimes.unchangedOnDisk(path, newPath); ok {
+			if e.manifest != nil {
+				sum, size, err := hashFile(newPath)
+				if err != nil {
+					return errs.WithEF(err, data.WithField("path", newPath), "Failed to hash extracted file")
+				}
+				return e.recordExtracted(path, ManifestEntry{Size: size, Mode: entry.Mode, Sha256: sum}, false)
+			}
+			return nil
+		}
+		if err := os.Remove(newPath); err != nil && !os.IsNotExist(err) {
+			return errs.WithEF(err, data.WithField("path", newPath), "Failed to remove outdated file")
+		}
+	}
+
+	if e.journal != nil {
+		if entry, ok := e.journal.completed(path, newPath); ok {
+			return e.recordExtracted(path, entry, false)
+		}
+		if err := os.Remove(newPath); err != nil && !os.IsNotExist(err) {
+			return errs.WithEF(err, data.WithField("path", newPath), "Failed to remove partially extracted file")
+		}
+	}
+
+	r, err := app.embeddedFS().Open(path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	info, err := r.Stat()
+	if err != nil {
+		return err
+	}
+	if e.maxFileSize > 0 && info.Size() > e.maxFileSize {
+		return errs.WithF(data.WithField("path", path).WithField("size", info.Size()).WithField("max", e.maxFileSize), "Embedded file exceeds max size")
+	}
+	mode := e.fileMode(path, info.Mode())
+	if e.readOnly {
+		mode &^= 0222
+	}
+	if e.previous != nil {
+		if entry, ok := app.reusePrevious(e, path, newPath, mode); ok {
+			if e.verifyArch {
+				if err := verifyExecArch(newPath); err != nil {
+					return err
+				}
+			}
+			return e.recordExtracted(path, entry, true)
+		}
+	}
+	createMode := mode
+	if e.provenance != nil {
+		// user extended attributes need write permission, given back once they are set
+		createMode |= 0200
+	}
+	w, err := os.OpenFile(newPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, createMode)
+	if err != nil {
+		return err
+	}
+
+	var dst io.Writer = w
+	hash := sha256.New()
+	if e.manifest != nil || e.journal != nil || e.verify != nil {
+		dst = io.MultiWriter(w, hash)
+	}
+	size, err := io.Copy(dst, r)
+	if err != nil {
+		w.Close()
+		return errs.WithEF(err, data.WithField("path", path), "Failed to extract embedded")
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	if e.provenance != nil {
+		e.provenance.record(newPath)
+		if createMode != mode {
+			if err := os.Chmod(newPath, mode); err != nil {
+				return errs.WithEF(err, data.WithField("path", newPath), "Failed to set extracted file mode")
+			}
+		}
+	}
+	if e.verifyArch {
+		if err := verifyExecArch(newPath); err != nil {
+			return err
+		}
+	}
+	if e.mtimes != nil {
+		if entry, ok := e.mtimes[filepath.ToSlash(path)]; ok && entry.ModTime != 0 {
+			modTime := time.Unix(entry.ModTime, 0)
+			if err := os.Chtimes(newPath, modTime, modTime); err != nil {
+				return errs.WithEF(err, data.WithField("path", newPath), "Failed to set extracted file mtime")
+			}
+		}
+	}
+
+	entry := ManifestEntry{
+		Size:   size,
+		Mode:   mode,
+		Sha256: hex.EncodeToString(hash.Sum(nil)),
+	}
+	if e.verify != nil {
+		if expected, ok := e.verify[filepath.ToSlash(path)]; !ok || expected.Sha256 != entry.Sha256 {
+			_ = os.Remove(newPath)
+			return errs.WithF(data.WithField("path", path).WithField("sha256", entry.Sha256).WithField("expected", expected.Sha256), "Embedded file does not match embedded manifest, binary may be corrupted")
+		}
+	}
+	return e.recordExtracted(path, entry, true)
+}
+
+// fileMode returns the permissions of an extracted file, from the embedded manifest when it has them,
+// without setuid, setgid and sticky bits, and always writable by its owner so it can be replaced
+func (e *extraction) fileMode(path string, embeddedMode fs.FileMode) fs.FileMode {
+	if entry, ok := e.modes[filepath.ToSlash(path)]; ok && entry.Mode.Perm() != 0 {
+		return entry.Mode.Perm() | 0200
+	}
+	return embeddedMode.Perm() | 0200
+}
+
+// readEmbeddedManifest returns the build time manifest of the embedded FS, or nil if there is none
+func (app *App) readEmbeddedManifest() (Manifest, error) {
+	bytes, err := fs.ReadFile(app.embeddedFS(), pathEmbeddedManifest)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errs.WithE(err, "Failed to read embedded manifest")
+	}
+	manifest := Manifest{}
+	if err := json.Unmarshal(bytes, &manifest); err != nil {
+		return nil, errs.WithE(err, "Failed to parse embedded manifest")
+	}
+	return manifest, nil
+}
+
+// checkEmbeddedFileCount catches an embed directive that matched more or less files than expected
+func (app *App) checkEmbeddedFileCount() error {
+	entries, err := app.embeddedEntries()
+	if err != nil {
+		return errs.WithE(err, "Failed to count embedded files")
+	}
+	count := 0
+	for _, entry := range entries {
+		if entry.regular && !controlFile(entry.path) {
+			count++
+		}
+	}
+	if count != app.ExpectedEmbeddedFileCount {
+		return errs.WithF(data.WithField("count", count).WithField("expected", app.ExpectedEmbeddedFileCount), "Embedded file count differs from expected, check the embed directive")
+	}
+	return nil
+}
+
+func (app *App) checkInodes() error {
+	entries, err := app.embeddedEntries()
+	if err != nil {
+		return errs.WithE(err, "Failed to count embedded files")
+	}
+	count := uint64(len(entries))
+
+	free, ok, err := freeInodes(app.cacheHome())
+	if err != nil {
+		return errs.WithEF(err, data.WithField("path", app.cacheHome()), "Failed to read filesystem free inodes")
+	}
+	if ok && free < count {
+		return errs.WithF(data.WithField("path", app.cacheHome()).WithField("free", free).WithField("needed", count), "Insufficient inodes to extract embedded")
+	}
+	return nil
+}
+
+func hashFile(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	size, err := io.Copy(hash, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), size, nil
+}
@@ -0,0 +1,962 @@
+package app
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"embed"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofrs/flock"
+	"github.com/stretchr/testify/assert"
+)
+
+//go:embed testdata/embedded
+var testEmbedded embed.FS
+
+func newTestApp() *App {
+	return &App{Name: "test", Version: "1.0.0", Embedded: &testEmbedded, SystemConfigPaths: []string{}}
+}
+
+// only written manifests are deterministic, the extraction journal is in completion order
+func TestExtractionManifestIsDeterministic(t *testing.T) {
+	var manifests []string
+	for i := 0; i < 3; i++ {
+		app := newTestApp()
+		app.ExtractConcurrency = 4
+		app.WriteExtractionManifest = true
+		home := t.TempDir()
+		assert.NoError(t, app.Init(home, &struct{}{}))
+
+		manifest, err := os.ReadFile(filepath.Join(home, pathManifest))
+		assert.NoError(t, err)
+		manifests = append(manifests, string(manifest))
+		extracted, err := os.ReadFile(filepath.Join(app.EmbeddedPath, PathExtractedManifest))
+		assert.NoError(t, err)
+		assert.Equal(t, string(manifest), string(extracted))
+	}
+
+	assert.Contains(t, manifests[0], "testdata/embedded/sub/c.txt")
+	assert.Less(t, strings.Index(manifests[0], "testdata/embedded/a.txt"), strings.Index(manifests[0], "testdata/embedded/sub/b.txt"))
+	assert.Equal(t, manifests[0], manifests[1])
+	assert.Equal(t, manifests[0], manifests[2])
+}
+
+func TestEmbeddedEntriesAreSorted(t *testing.T) {
+	entries, err := newTestApp().embeddedEntries()
+	assert.NoError(t, err)
+
+	var paths []string
+	for _, entry := range entries {
+		paths = append(paths, entry.path)
+	}
+	assert.Equal(t, []string{
+		".",
+		"testdata",
+		"testdata/embedded",
+		"testdata/embedded/a-b.txt",
+		"testdata/embedded/a.txt",
+		"testdata/embedded/sub",
+		"testdata/embedded/sub/b.txt",
+		"testdata/embedded/sub/c.txt",
+	}, paths)
+}
+
+func TestTarEmbedded(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, newTestApp().TarEmbedded(&buf))
+
+	contents := map[string]string{}
+	reader := tar.NewReader(&buf)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		content, err := io.ReadAll(reader)
+		assert.NoError(t, err)
+		contents[header.Name] = string(content)
+	}
+	assert.Equal(t, "first\n", contents["testdata/embedded/a.txt"])
+	assert.Contains(t, contents, "testdata/embedded/sub/")
+	assert.Len(t, contents, 7)
+}
+
+func TestTarEmbeddedAsExtracted(t *testing.T) {
+	app := newTestApp()
+	app.EmbeddedChannel = "testdata"
+	app.ReadOnlyExtract = true
+	app.ExtractIf = map[string]func() bool{"testdata/embedded/sub": func() bool { return false }}
+	var buf bytes.Buffer
+	assert.NoError(t, app.TarEmbedded(&buf))
+
+	modes := map[string]int64{}
+	reader := tar.NewReader(&buf)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		modes[header.Name] = header.Mode
+	}
+	assert.Equal(t, map[string]int64{"embedded/": 0755, "embedded/a.txt": 0444, "embedded/a-b.txt": 0444}, modes)
+
+	// modes of the embedded manifest apply
+	buf.Reset()
+	tw := tar.NewWriter(&buf)
+	e := &extraction{modes: Manifest{"testdata/embedded/a.txt": {Mode: 0755}}}
+	assert.NoError(t, newTestApp().tarEntry(tw, e, embeddedEntry{path: "testdata/embedded/a.txt", regular: true}, "a.txt"))
+	assert.NoError(t, tw.Close())
+	header, err := tar.NewReader(&buf).Next()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0755), header.Mode)
+}
+
+func TestResumableExtract(t *testing.T) {
+	home := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	var first string
+	app := newTestApp()
+	app.ResumableExtract = true
+	app.OnExtractProgress = func(done, total int, path string) {
+		if done == 1 {
+			first = path
+			cancel()
+		}
+	}
+	assert.Error(t, app.InitContext(ctx, home, &struct{}{}))
+	assert.FileExists(t, filepath.Join(home, pathJournal))
+	// marks the file completed before the interruption, the journal only checks its content
+	marked := time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)
+	assert.NoError(t, os.Chtimes(filepath.Join(home, pathEmbedded, "1.0.0", first), marked, marked))
+
+	resumed := newTestApp()
+	resumed.ResumableExtract = true
+	assert.NoError(t, resumed.Init(home, &struct{}{}))
+
+	kept, err := os.Stat(filepath.Join(resumed.EmbeddedPath, first))
+	assert.NoError(t, err)
+	assert.True(t, kept.ModTime().Equal(marked))
+	assert.NoFileExists(t, filepath.Join(home, pathJournal))
+	assert.NoError(t, resumed.VerifyEmbedded())
+}
+
+func TestExtractByMtime(t *testing.T) {
+	target := t.TempDir()
+	app := newTestApp()
+	built := time.Unix(1700000000, 0)
+	mtimes := Manifest{
+		"testdata/embedded/a.txt":     {ModTime: built.Unix()},
+		"testdata/embedded/sub/b.txt": {ModTime: built.Unix()},
+	}
+	assert.NoError(t, app.extractEmbedded(&extraction{target: target, manifest: Manifest{}, mtimes: mtimes, concurrency: 1}))
+	info, err := os.Stat(filepath.Join(target, "testdata/embedded/a.txt"))
+	assert.NoError(t, err)
+	assert.True(t, info.ModTime().Equal(built))
+
+	// a file still at its build time is considered unchanged, another one is outdated
+	assert.NoError(t, os.WriteFile(filepath.Join(target, "testdata/embedded/a.txt"), []byte("kept\n"), 0644))
+	assert.NoError(t, os.Chtimes(filepath.Join(target, "testdata/embedded/a.txt"), built, built))
+	assert.NoError(t, os.WriteFile(filepath.Join(target, "testdata/embedded/sub/b.txt"), []byte("outdated\n"), 0644))
+
+	e := &extraction{target: target, manifest: Manifest{}, mtimes: mtimes, concurrency: 1}
+	assert.NoError(t, app.extractEmbedded(e))
+	content, err := os.ReadFile(filepath.Join(target, "testdata/embedded/a.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "kept\n", string(content))
+	content, err = os.ReadFile(filepath.Join(target, "testdata/embedded/sub/b.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "nested\n", string(content))
+	assert.Equal(t, int64(len("kept\n")), e.manifest["testdata/embedded/a.txt"].Size)
+}
+
+func TestVerifyOnExtract(t *testing.T) {
+	app := newTestApp()
+	verify := Manifest{}
+	for _, path := range []string{"testdata/embedded/a.txt", "testdata/embedded/a-b.txt", "testdata/embedded/sub/b.txt", "testdata/embedded/sub/c.txt"} {
+		sum, size, err := hashEmbeddedFile(app.embeddedFS(), path)
+		assert.NoError(t, err)
+		verify[path] = ManifestEntry{Size: size, Sha256: sum}
+	}
+	target := t.TempDir()
+	assert.NoError(t, app.extractEmbedded(&extraction{target: target, verify: verify, concurrency: 1}))
+	assert.FileExists(t, filepath.Join(target, "testdata/embedded/sub/b.txt"))
+
+	verify["testdata/embedded/sub/b.txt"] = ManifestEntry{Size: 7, Sha256: strings.Repeat("0", 64)}
+	target = t.TempDir()
+	err := app.extractEmbedded(&extraction{target: target, verify: verify, concurrency: 1})
+	assert.ErrorContains(t, err, "testdata/embedded/sub/b.txt")
+	assert.NoFileExists(t, filepath.Join(target, "testdata/embedded/sub/b.txt"))
+}
+
+func TestStageAndActivate(t *testing.T) {
+	home := t.TempDir()
+	app := newTestApp()
+	assert.NoError(t, app.Init(home, &struct{}{}))
+
+	next := newTestApp()
+	next.Version = "1.1.0"
+	assert.NoError(t, app.StageAndActivate(next))
+
+	assert.Equal(t, "1.1.0", app.Version)
+	assert.Equal(t, filepath.Join(home, pathEmbedded, "1.1.0"), app.EmbeddedPath)
+	content, err := fs.ReadFile(app.EmbeddedFS(), "testdata/embedded/sub/b.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "nested\n", string(content))
+	version, err := os.ReadFile(filepath.Join(home, pathVersion))
+	assert.NoError(t, err)
+	assert.Equal(t, "1.1.0", string(version))
+	assert.DirExists(t, filepath.Join(home, pathEmbedded, "1.0.0"))
+}
+
+func TestStageAndActivateExtractionOptions(t *testing.T) {
+	home := t.TempDir()
+	app := newTestApp()
+	assert.NoError(t, app.Init(home, &struct{}{}))
+
+	next := newTestApp()
+	next.Version = "1.1.0"
+	next.EmbeddedChannel = "testdata"
+	next.ReadOnlyExtract = true
+	next.ExtractIf = map[string]func() bool{"testdata/embedded/sub": func() bool { return false }}
+	assert.NoError(t, app.StageAndActivate(next))
+
+	assert.Equal(t, filepath.Join(home, pathEmbedded, "1.1.0", "testdata"), app.EmbeddedPath)
+	assert.FileExists(t, filepath.Join(app.EmbeddedPath, "embedded", "a.txt"))
+	assert.NoDirExists(t, filepath.Join(app.EmbeddedPath, "embedded", "sub"))
+	info, err := os.Stat(filepath.Join(app.EmbeddedPath, "embedded", "a.txt"))
+	assert.NoError(t, err)
+	assert.Zero(t, info.Mode().Perm()&0222)
+	assert.NoError(t, app.VerifyEmbedded())
+}
+
+func TestStageAndActivateSameVersion(t *testing.T) {
+	home := t.TempDir()
+	app := newTestApp()
+	app.ReadOnlyExtract = true
+	assert.NoError(t, app.Init(home, &struct{}{}))
+	active := app.EmbeddedPath
+
+	again := newTestApp()
+	again.ReadOnlyExtract = true
+	assert.NoError(t, app.StageAndActivate(again))
+	assert.Equal(t, active, app.EmbeddedPath)
+	assert.NoError(t, app.VerifyEmbedded())
+	leftovers, err := filepath.Glob(filepath.Join(home, pathEmbedded, "*.tmp-*"))
+	assert.NoError(t, err)
+	assert.Empty(t, leftovers)
+}
+
+func TestStageAndActivateLockTimeout(t *testing.T) {
+	home := t.TempDir()
+	app := newTestApp()
+	assert.NoError(t, app.Init(home, &struct{}{}))
+
+	lock := flock.New(filepath.Join(home, pathLock))
+	assert.NoError(t, lock.Lock())
+	defer lock.Unlock()
+
+	app.LockTimeout = 100 * time.Millisecond
+	next := newTestApp()
+	next.Version = "1.1.0"
+	assert.Equal(t, ErrHomeLocked, app.StageAndActivate(next))
+	assert.Equal(t, "1.0.0", app.Version)
+}
+
+func TestEmbeddedContentHash(t *testing.T) {
+	app := newTestApp()
+	var wg sync.WaitGroup
+	sums := make([]string, 4)
+	for i := range sums {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sum, err := app.EmbeddedContentHash()
+			assert.NoError(t, err)
+			sums[i] = sum
+		}()
+	}
+	wg.Wait()
+
+	assert.Len(t, sums[0], 64)
+	for _, sum := range sums {
+		assert.Equal(t, sums[0], sum)
+	}
+	other, err := newTestApp().computeEmbeddedContentHash()
+	assert.NoError(t, err)
+	assert.Equal(t, sums[0], other)
+}
+
+func TestExtractRoutes(t *testing.T) {
+	home := t.TempDir()
+	app := newTestApp()
+	app.ExtractRoutes = []ExtractRoute{
+		{Match: "testdata/embedded/sub/*", Destination: "data"},
+		{Match: "a.txt", Destination: "etc"},
+	}
+	assert.NoError(t, app.Init(home, &struct{}{}))
+
+	assert.FileExists(t, filepath.Join(home, "data", "b.txt"))
+	assert.FileExists(t, filepath.Join(home, "data", "c.txt"))
+	assert.FileExists(t, filepath.Join(home, "etc", "a.txt"))
+	assert.NoFileExists(t, filepath.Join(app.EmbeddedPath, "testdata/embedded/a.txt"))
+	assert.FileExists(t, filepath.Join(app.EmbeddedPath, "testdata/embedded/a-b.txt"))
+
+	assert.NoError(t, os.Remove(filepath.Join(home, pathVersion)))
+	assert.NoError(t, app.Init(home, &struct{}{}))
+}
+
+func TestExtractRoutesOutsideHome(t *testing.T) {
+	for _, destination := range []string{"../bin", "/usr/local/bin", "bin/../../bin"} {
+		home := t.TempDir()
+		app := newTestApp()
+		app.ExtractRoutes = []ExtractRoute{{Match: "a.txt", Destination: destination}}
+		assert.Error(t, app.Init(home, &struct{}{}), destination)
+		assert.NoFileExists(t, filepath.Join(filepath.Dir(home), "bin", "a.txt"))
+	}
+}
+
+func TestExtractRoutesCollision(t *testing.T) {
+	e := &extraction{}
+	assert.NoError(t, e.claimRoutedPath("a/run.sh", "/home/bin/run.sh"))
+	assert.NoError(t, e.claimRoutedPath("a/run.sh", "/home/bin/run.sh"))
+	assert.NoError(t, e.claimRoutedPath("b/other.sh", "/home/bin/other.sh"))
+	assert.Error(t, e.claimRoutedPath("b/run.sh", "/home/bin/run.sh"))
+
+	e.restart("")
+	assert.NoError(t, e.claimRoutedPath("b/run.sh", "/home/bin/run.sh"))
+}
+
+func TestExtractRoutesReservedEntries(t *testing.T) {
+	for _, destination := range []string{"embedded", "embedded/1.0.0", "pids", "./lock", "config.yaml"} {
+		home := t.TempDir()
+		app := newTestApp()
+		app.ExtractRoutes = []ExtractRoute{{Match: "a.txt", Destination: destination}}
+		assert.Error(t, app.Init(home, &struct{}{}), destination)
+	}
+
+	home := t.TempDir()
+	e := &extraction{home: home}
+	for _, name := range []string{"config.yaml", "config.toml", "lock", "version", "prepared", "manifest.json", "pids", "embedded", "extract.journal"} {
+		assert.Error(t, e.claimRoutedPath("files/"+name, filepath.Join(home, name)), name)
+	}
+	assert.NoError(t, e.claimRoutedPath("files/a.txt", filepath.Join(home, "a.txt")))
+	assert.NoError(t, e.claimRoutedPath("files/lock", filepath.Join(home, "bin", "lock")))
+}
+
+func TestSafeReextract(t *testing.T) {
+	previousWait := safeReextractWait
+	t.Cleanup(func() { safeReextractWait = previousWait })
+	safeReextractWait = 0
+
+	home := t.TempDir()
+	app := newTestApp()
+	app.SafeReextract = true
+	assert.NoError(t, app.Init(home, &struct{}{}))
+	used := app.EmbeddedPath
+
+	// a sibling still running on the embedded, while another version was initialized since
+	assert.NoError(t, os.WriteFile(app.pidsPath(filepath.Base(used)), []byte(strconv.Itoa(os.Getppid())+"\n"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(home, pathVersion), []byte("0.9.0"), 0644))
+
+	again := newTestApp()
+	again.SafeReextract = true
+	assert.NoError(t, again.Init(home, &struct{}{}))
+	assert.Equal(t, used+"+"+strconv.Itoa(os.Getpid()), again.EmbeddedPath)
+	assert.FileExists(t, filepath.Join(used, "testdata/embedded/a.txt"))
+	assert.FileExists(t, filepath.Join(again.EmbeddedPath, "testdata/embedded/a.txt"))
+}
+
+func TestSafeReextractWaitsForExit(t *testing.T) {
+	home := t.TempDir()
+	app := newTestApp()
+	app.SafeReextract = true
+	assert.NoError(t, app.Init(home, &struct{}{}))
+	used := app.EmbeddedPath
+
+	sibling := exec.Command("sleep", "0.3")
+	assert.NoError(t, sibling.Start())
+	go sibling.Wait()
+	assert.NoError(t, os.WriteFile(app.pidsPath(filepath.Base(used)), []byte(strconv.Itoa(sibling.Process.Pid)+"\n"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(home, pathVersion), []byte("0.9.0"), 0644))
+
+	start := time.Now()
+	again := newTestApp()
+	again.SafeReextract = true
+	assert.NoError(t, again.Init(home, &struct{}{}))
+	assert.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond)
+	assert.Equal(t, used, again.EmbeddedPath)
+	assert.NoDirExists(t, used+"+"+strconv.Itoa(os.Getpid()))
+}
+
+func TestLocales(t *testing.T) {
+	home := t.TempDir()
+	app := newTestApp()
+	app.EmbeddedLocaleDir = "testdata/embedded"
+	app.Locales = []string{"fr"}
+	assert.NoError(t, app.Init(home, &struct{}{}))
+
+	assert.FileExists(t, filepath.Join(app.EmbeddedPath, "testdata/embedded/a.txt"))
+	assert.NoDirExists(t, filepath.Join(app.EmbeddedPath, "testdata/embedded/sub"))
+}
+
+func TestReadOnlyExtract(t *testing.T) {
+	home := t.TempDir()
+	app := newTestApp()
+	app.ReadOnlyExtract = true
+	assert.NoError(t, app.Init(home, &struct{}{}))
+
+	info, err := os.Stat(filepath.Join(app.EmbeddedPath, "testdata/embedded/sub/b.txt"))
+	assert.NoError(t, err)
+	assert.Zero(t, info.Mode().Perm()&0222)
+	info, err = os.Stat(filepath.Join(app.EmbeddedPath, "testdata/embedded/sub"))
+	assert.NoError(t, err)
+	assert.Equal(t, fs.FileMode(0555), info.Mode().Perm())
+
+	assert.NoError(t, os.WriteFile(filepath.Join(home, pathVersion), []byte("0.9.0"), 0644))
+	assert.NoError(t, app.Init(home, &struct{}{}))
+	assert.NoError(t, removeTree(app.EmbeddedPath))
+}
+
+func TestExtractIf(t *testing.T) {
+	home := t.TempDir()
+	supported := false
+	app := newTestApp()
+	app.ExtractIf = map[string]func() bool{"testdata/embedded/sub/": func() bool { return supported }}
+	assert.NoError(t, app.Init(home, &struct{}{}))
+	assert.FileExists(t, filepath.Join(app.EmbeddedPath, "testdata/embedded/a.txt"))
+	assert.NoDirExists(t, filepath.Join(app.EmbeddedPath, "testdata/embedded/sub"))
+
+	supported = true
+	assert.NoError(t, app.Init(home, &struct{}{}))
+	assert.FileExists(t, filepath.Join(app.EmbeddedPath, "testdata/embedded/sub/b.txt"))
+}
+
+func TestExtractIfWithChannel(t *testing.T) {
+	home := t.TempDir()
+	app := newTestApp()
+	app.EmbeddedChannel = "testdata"
+	app.ExtractIf = map[string]func() bool{"testdata/embedded/sub": func() bool { return true }}
+	assert.NoError(t, app.Init(home, &struct{}{}))
+	assert.FileExists(t, filepath.Join(app.EmbeddedPath, "embedded/sub/b.txt"))
+
+	result, err := app.InitWithResult(home, &struct{}{})
+	assert.NoError(t, err)
+	assert.False(t, result.Extracted)
+}
+
+func TestExtractIfWithLocales(t *testing.T) {
+	home := t.TempDir()
+	app := newTestApp()
+	app.EmbeddedLocaleDir = "testdata/embedded"
+	app.Locales = []string{"fr"}
+	app.ExtractIf = map[string]func() bool{"testdata/embedded/sub": func() bool { return true }}
+	assert.NoError(t, app.Init(home, &struct{}{}))
+	assert.NoDirExists(t, filepath.Join(app.EmbeddedPath, "testdata/embedded/sub"))
+
+	result, err := app.InitWithResult(home, &struct{}{})
+	assert.NoError(t, err)
+	assert.False(t, result.Extracted)
+}
+
+func TestMissingConditionalExclusions(t *testing.T) {
+	extracted := t.TempDir()
+	conditions := map[string]func() bool{"testdata/embedded/sub": func() bool { return true }}
+	assert.True(t, (&extraction{}).missingConditional(testEmbedded, conditions, extracted))
+
+	excludedLocale := &extraction{localeDir: "testdata/embedded", locales: []string{"fr"}}
+	assert.False(t, excludedLocale.missingConditional(testEmbedded, conditions, extracted))
+	includedLocale := &extraction{localeDir: "testdata/embedded", locales: []string{"sub"}}
+	assert.True(t, includedLocale.missingConditional(testEmbedded, conditions, extracted))
+
+	rules, err := parseIgnore("sub/\n")
+	assert.NoError(t, err)
+	assert.False(t, (&extraction{ignore: rules}).missingConditional(testEmbedded, conditions, extracted))
+	rules, err = parseIgnore("*.txt\n")
+	assert.NoError(t, err)
+	assert.True(t, (&extraction{ignore: rules}).missingConditional(testEmbedded, conditions, extracted))
+
+	assert.False(t, (&extraction{channel: "other"}).missingConditional(testEmbedded, conditions, extracted))
+}
+
+func TestExpectedEmbeddedFileCount(t *testing.T) {
+	app := newTestApp()
+	app.ExpectedEmbeddedFileCount = 4
+	assert.NoError(t, app.Init(t.TempDir(), &struct{}{}))
+
+	app = newTestApp()
+	app.ExpectedEmbeddedFileCount = 5
+	assert.Error(t, app.Init(t.TempDir(), &struct{}{}))
+
+	for _, path := range []string{pathEmbeddedManifest, pathEmbeddedIgnore, pathEmbeddedSymlinks} {
+		assert.True(t, controlFile(path), path)
+	}
+	assert.False(t, controlFile("sub/"+pathEmbeddedIgnore))
+}
+
+func TestCheckInodes(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("free inodes are only read on linux and darwin")
+	}
+	app := newTestApp()
+	app.CheckInodes = true
+	assert.NoError(t, app.Init(t.TempDir(), &struct{}{}))
+
+	app = newTestApp()
+	app.Home = filepath.Join(t.TempDir(), "missing")
+	assert.Error(t, app.checkInodes())
+}
+
+func TestInitWithDeadline(t *testing.T) {
+	home := t.TempDir()
+	app := newTestApp()
+	result, err := app.InitWithDeadline(home, &struct{}{}, time.Now().Add(-time.Second))
+	assert.Error(t, err)
+	assert.Nil(t, result)
+
+	// a slow probe makes the deadline pass once the extraction started
+	app.ExtractIf = map[string]func() bool{"testdata/embedded/sub": func() bool {
+		time.Sleep(200 * time.Millisecond)
+		return true
+	}}
+	result, err = app.InitWithDeadline(home, &struct{}{}, time.Now().Add(100*time.Millisecond))
+	assert.NoError(t, err)
+	assert.False(t, result.ExtractionComplete)
+	assert.NoFileExists(t, filepath.Join(home, pathVersion))
+	staged, err := filepath.Glob(filepath.Join(home, pathEmbedded, "*"))
+	assert.NoError(t, err)
+	assert.Empty(t, staged)
+
+	app.ExtractIf = nil
+	result, err = app.InitWithDeadline(home, &struct{}{}, time.Now().Add(time.Minute))
+	assert.NoError(t, err)
+	assert.True(t, result.ExtractionComplete)
+	assert.FileExists(t, filepath.Join(home, pathVersion))
+}
+
+func TestEmbeddedChannel(t *testing.T) {
+	home := t.TempDir()
+	app := newTestApp()
+	app.EmbeddedChannel = "testdata"
+	assert.NoError(t, app.Init(home, &struct{}{}))
+	assert.Equal(t, filepath.Join(home, pathEmbedded, "1.0.0", "testdata"), app.EmbeddedPath)
+	assert.FileExists(t, filepath.Join(app.EmbeddedPath, "embedded/a.txt"))
+
+	app.EmbeddedChannel = "beta"
+	assert.Error(t, app.Init(home, &struct{}{}))
+}
+
+func TestVerifyEmbedded(t *testing.T) {
+	home := t.TempDir()
+	app := newTestApp()
+	assert.NoError(t, app.Init(home, &struct{}{}))
+	assert.FileExists(t, filepath.Join(app.EmbeddedPath, PathExtractedManifest))
+	assert.NoError(t, app.VerifyEmbedded())
+
+	tampered := filepath.Join(app.EmbeddedPath, "testdata/embedded/sub/b.txt")
+	assert.NoError(t, os.WriteFile(tampered, []byte("tampered"), 0644))
+	assert.Error(t, app.VerifyEmbedded())
+
+	assert.NoError(t, app.Init(home, &struct{}{}))
+	content, err := os.ReadFile(tampered)
+	assert.NoError(t, err)
+	assert.Equal(t, "nested\n", string(content))
+}
+
+func TestExtractProgressWriter(t *testing.T) {
+	progress := &bytes.Buffer{}
+	app := newTestApp()
+	app.ExtractProgressWriter = progress
+	app.ExtractConcurrency = 1
+	assert.NoError(t, app.Init(t.TempDir(), &struct{}{}))
+
+	assert.Equal(t, "extracted testdata/embedded/a-b.txt (1/4)\n"+
+		"extracted testdata/embedded/a.txt (2/4)\n"+
+		"extracted testdata/embedded/sub/b.txt (3/4)\n"+
+		"extracted testdata/embedded/sub/c.txt (4/4)\n", progress.String())
+}
+
+func TestOnExtractProgress(t *testing.T) {
+	var dones []int
+	paths := map[string]bool{}
+	app := newTestApp()
+	app.OnExtractProgress = func(done, total int, path string) {
+		assert.Equal(t, 4, total)
+		dones = append(dones, done)
+		paths[path] = true
+	}
+	assert.NoError(t, app.Init(t.TempDir(), &struct{}{}))
+
+	assert.Equal(t, []int{1, 2, 3, 4}, dones)
+	assert.Len(t, paths, 4)
+	assert.True(t, paths["testdata/embedded/sub/c.txt"])
+}
+
+func TestMaxEmbeddedFileSize(t *testing.T) {
+	app := newTestApp()
+	app.MaxEmbeddedFileSize = 11
+	assert.NoError(t, app.Init(t.TempDir(), &struct{}{}))
+
+	app = newTestApp()
+	app.MaxEmbeddedFileSize = 10
+	err := app.Init(t.TempDir(), &struct{}{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "sub/c.txt")
+}
+
+func TestExtractConcurrency(t *testing.T) {
+	manifests := map[int]string{}
+	for _, concurrency := range []int{1, 4} {
+		app := newTestApp()
+		app.ExtractConcurrency = concurrency
+		app.WriteExtractionManifest = true
+		home := t.TempDir()
+		assert.NoError(t, app.Init(home, &struct{}{}))
+		manifest, err := os.ReadFile(filepath.Join(home, pathManifest))
+		assert.NoError(t, err)
+		manifests[concurrency] = string(manifest)
+	}
+	assert.Equal(t, manifests[1], manifests[4])
+
+	app := newTestApp()
+	app.ExtractConcurrency = 4
+	app.MaxEmbeddedFileSize = 10
+	home := t.TempDir()
+	assert.Error(t, app.Init(home, &struct{}{}))
+	assert.NoDirExists(t, filepath.Join(home, pathEmbedded, "1.0.0"))
+}
+
+func TestIncrementalExtract(t *testing.T) {
+	home := t.TempDir()
+	app := newTestApp()
+	app.IncrementalExtract = true
+	assert.NoError(t, app.Init(home, &struct{}{}))
+	previous := app.EmbeddedPath
+	assert.NoError(t, os.WriteFile(filepath.Join(previous, "testdata/embedded/sub/b.txt"), []byte("tampered\n"), 0644))
+
+	upgraded := newTestApp()
+	upgraded.Version = "1.0.1"
+	upgraded.IncrementalExtract = true
+	assert.NoError(t, upgraded.Init(home, &struct{}{}))
+
+	linked, err := os.Stat(filepath.Join(upgraded.EmbeddedPath, "testdata/embedded/a.txt"))
+	assert.NoError(t, err)
+	original, err := os.Stat(filepath.Join(previous, "testdata/embedded/a.txt"))
+	assert.NoError(t, err)
+	assert.True(t, os.SameFile(original, linked))
+
+	content, err := os.ReadFile(filepath.Join(upgraded.EmbeddedPath, "testdata/embedded/sub/b.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "nested\n", string(content))
+	assert.NoError(t, upgraded.VerifyEmbedded())
+
+	// a modified file of the current version is extracted again, the others are kept
+	assert.NoError(t, os.WriteFile(filepath.Join(upgraded.EmbeddedPath, "testdata/embedded/sub/c.txt"), []byte("tampered\n"), 0644))
+	again := newTestApp()
+	again.Version = "1.0.1"
+	again.IncrementalExtract = true
+	assert.NoError(t, again.Init(home, &struct{}{}))
+	kept, err := os.Stat(filepath.Join(again.EmbeddedPath, "testdata/embedded/a.txt"))
+	assert.NoError(t, err)
+	assert.True(t, os.SameFile(original, kept))
+	assert.NoError(t, again.VerifyEmbedded())
+}
+
+func TestVerifyReadAfterInit(t *testing.T) {
+	app := newTestApp()
+	app.VerifyReadAfterInit = "testdata/embedded/sub/b.txt"
+	assert.NoError(t, app.Init(t.TempDir(), &struct{}{}))
+
+	app = newTestApp()
+	app.VerifyReadAfterInit = "testdata/embedded/missing.txt"
+	err := app.Init(t.TempDir(), &struct{}{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unreadable")
+	assert.Contains(t, err.Error(), "missing.txt")
+
+	app = newTestApp()
+	app.VerifyReadAfterInit = "../lock"
+	assert.Error(t, app.Init(t.TempDir(), &struct{}{}))
+}
+
+func TestExtractEmbeddedTo(t *testing.T) {
+	target := filepath.Join(t.TempDir(), "dist")
+	app := newTestApp()
+	app.EmbeddedChannel = "testdata/embedded"
+	assert.NoError(t, app.ExtractEmbeddedTo(target))
+
+	content, err := os.ReadFile(filepath.Join(target, "sub", "c.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "nested too\n", string(content))
+	assert.NoFileExists(t, filepath.Join(target, PathExtractedManifest))
+	assert.Error(t, app.ExtractEmbeddedTo(target))
+}
+
+func TestEmbeddedPrefix(t *testing.T) {
+	app := newTestApp()
+	app.EmbeddedPrefix = "testdata/embedded"
+	assert.NoError(t, app.Init(t.TempDir(), &struct{}{}))
+	assert.FileExists(t, filepath.Join(app.EmbeddedPath, "a.txt"))
+	assert.FileExists(t, filepath.Join(app.EmbeddedPath, "sub", "b.txt"))
+	assert.NoDirExists(t, filepath.Join(app.EmbeddedPath, "testdata"))
+	assert.NoError(t, app.VerifyEmbedded())
+
+	app = newTestApp()
+	app.EmbeddedPrefix = "assets"
+	assert.Error(t, app.Init(t.TempDir(), &struct{}{}))
+}
+
+func TestExtractedFileMode(t *testing.T) {
+	target := t.TempDir()
+	app := newTestApp()
+	e := &extraction{target: target, modes: Manifest{
+		"testdata/embedded/sub/b.txt": {Mode: fs.ModeSetuid | 0755},
+		"testdata/embedded/sub/c.txt": {Mode: 0600},
+	}}
+	for name, expected := range map[string]os.FileMode{"a.txt": 0644, "sub/b.txt": 0755, "sub/c.txt": 0600} {
+		newPath := filepath.Join(target, filepath.FromSlash(name))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(newPath), 0755))
+		assert.NoError(t, app.extractFile(e, "testdata/embedded/"+name, newPath))
+		info, err := os.Stat(newPath)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, info.Mode(), name)
+	}
+}
+
+func TestInitAsync(t *testing.T) {
+	home := t.TempDir()
+	app := newTestApp()
+	result, err := app.InitAsync(home, &struct{}{})
+	assert.NoError(t, err)
+
+	// waits for the background extraction
+	path, err := app.EmbeddedFile("testdata/embedded/sub/c.txt")
+	assert.NoError(t, err)
+	content, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "nested too\n", string(content))
+	assert.NoError(t, <-result)
+
+	version, err := os.ReadFile(filepath.Join(home, pathVersion))
+	assert.NoError(t, err)
+	assert.Equal(t, "1.0.0", string(version))
+	assert.NoError(t, app.VerifyEmbedded())
+
+	// the home lock is released once done
+	again := newTestApp()
+	again.LockTimeout = 100 * time.Millisecond
+	assert.NoError(t, again.Init(home, &struct{}{}))
+}
+
+func TestInitAsyncPriorityWithIncrementalExtract(t *testing.T) {
+	home := t.TempDir()
+	app := newTestApp()
+	app.IncrementalExtract = true
+	assert.NoError(t, app.Init(home, &struct{}{}))
+	// the extracted tree no longer matching its manifest, the same version is extracted again
+	assert.NoError(t, os.WriteFile(filepath.Join(app.EmbeddedPath, "testdata/embedded/sub/b.txt"), []byte("tampered\n"), 0644))
+
+	again := newTestApp()
+	again.IncrementalExtract = true
+	again.ExtractPriority = []string{"testdata/embedded/a.txt"}
+	result, err := again.InitAsync(home, &struct{}{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = again.EmbeddedFile("testdata/embedded/a.txt")
+	assert.NoError(t, err)
+	assert.NoError(t, <-result)
+
+	content, err := os.ReadFile(filepath.Join(again.EmbeddedPath, "testdata/embedded/sub/b.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "nested\n", string(content))
+	assert.NoError(t, again.VerifyEmbedded())
+}
+
+func TestInitAsyncPriorityFileBeforeCompletion(t *testing.T) {
+	home := t.TempDir()
+	release := make(chan struct{})
+	app := newTestApp()
+	app.ExtractPriority = []string{"testdata/embedded/a.txt"}
+	app.OnExtractProgress = func(done, total int, path string) {
+		if path != "testdata/embedded/a.txt" {
+			<-release
+		}
+	}
+	result, err := app.InitAsync(home, &struct{}{})
+	assert.NoError(t, err)
+
+	path, err := app.EmbeddedFile("testdata/embedded/a.txt")
+	assert.NoError(t, err)
+	content, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "first\n", string(content))
+	select {
+	case <-result:
+		t.Fatal("background extraction completed before its files were released")
+	default:
+	}
+
+	close(release)
+	assert.NoError(t, <-result)
+	_, err = app.EmbeddedFile("testdata/embedded/sub/b.txt")
+	assert.NoError(t, err)
+}
+
+func TestInitAsyncExtractPriority(t *testing.T) {
+	home := t.TempDir()
+	app := newTestApp()
+	app.ExtractPriority = []string{"testdata/embedded/a.txt"}
+	result, err := app.InitAsync(home, &struct{}{})
+	assert.NoError(t, err)
+
+	path, err := app.EmbeddedFile("testdata/embedded/a.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(home, pathEmbedded, "1.0.0", "testdata/embedded/a.txt"), path)
+	assert.NoError(t, <-result)
+
+	_, err = app.EmbeddedFile("testdata/embedded/sub/b.txt")
+	assert.NoError(t, err)
+	staged, err := filepath.Glob(filepath.Join(home, pathEmbedded, "*.tmp-*"))
+	assert.NoError(t, err)
+	assert.Empty(t, staged)
+	assert.NoError(t, app.VerifyEmbedded())
+}
+
+func withRAMRoot(t *testing.T) string {
+	if runtime.GOOS != "linux" {
+		t.Skip("RAM extraction is only supported on linux")
+	}
+	previous := ramRoot
+	t.Cleanup(func() { ramRoot = previous })
+	ramRoot = t.TempDir()
+	return ramRoot
+}
+
+func TestPreferRAMExtract(t *testing.T) {
+	root := withRAMRoot(t)
+	app := newTestApp()
+	app.PreferRAMExtract = true
+	assert.NoError(t, app.Init(t.TempDir(), &struct{}{}))
+
+	private := filepath.Join(root, "test-"+strconv.Itoa(os.Getuid()))
+	assert.Equal(t, filepath.Join(private, "1.0.0"), app.EmbeddedPath)
+	assert.FileExists(t, filepath.Join(app.EmbeddedPath, "testdata/embedded/a.txt"))
+	info, err := os.Stat(private)
+	assert.NoError(t, err)
+	assert.Equal(t, fs.FileMode(0700), info.Mode().Perm())
+}
+
+func TestInitAsyncRAMFallback(t *testing.T) {
+	withRAMRoot(t)
+	home := t.TempDir()
+	app := newTestApp()
+	app.PreferRAMExtract = true
+	app.ExtractConcurrency = 1
+	app.ExtractPriority = []string{"testdata/embedded/a.txt"}
+	var ramPath string
+	var mutex sync.Mutex
+	var unavailable []error
+	app.OnExtractProgress = func(done, total int, path string) {
+		active := app.activeEmbeddedPath()
+		if path == "testdata/embedded/a-b.txt" && active != filepath.Join(home, pathEmbedded, "1.0.0") {
+			// breaks the RAM extraction of the next files
+			ramPath = active
+			assert.NoError(t, os.RemoveAll(filepath.Join(active, "testdata/embedded/sub")))
+			writeTestFile(t, filepath.Join(active, "testdata/embedded/sub"), "not a directory\n")
+		}
+	}
+	result, err := app.InitAsync(home, &struct{}{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	// the priority file is used all along the background extraction
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if _, err := app.EmbeddedFile("testdata/embedded/a.txt"); err != nil {
+				mutex.Lock()
+				unavailable = append(unavailable, err)
+				mutex.Unlock()
+			}
+		}
+	}()
+	assert.NoError(t, <-result)
+	close(stop)
+	<-done
+
+	assert.NotEmpty(t, ramPath)
+	assert.Empty(t, unavailable)
+	assert.Equal(t, filepath.Join(home, pathEmbedded, "1.0.0"), app.EmbeddedPath)
+	assert.NoDirExists(t, ramPath)
+	assert.NoError(t, app.VerifyEmbedded())
+}
+
+func TestStatusReportRAMExtract(t *testing.T) {
+	withRAMRoot(t)
+	app := newTestApp()
+	app.PreferRAMExtract = true
+	assert.NoError(t, app.Init(t.TempDir(), &struct{}{}))
+
+	status, err := app.StatusReport()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1.0.0"}, status.EmbeddedVersions)
+	assert.Empty(t, status.Problems)
+}
+
+func TestPreferRAMExtractRefusesSharedDirectory(t *testing.T) {
+	root := withRAMRoot(t)
+	shared := filepath.Join(root, "test-"+strconv.Itoa(os.Getuid()))
+	assert.NoError(t, os.MkdirAll(filepath.Join(shared, "1.0.0"), 0755))
+	assert.NoError(t, os.Chmod(shared, 0777))
+
+	home := t.TempDir()
+	app := newTestApp()
+	app.PreferRAMExtract = true
+	assert.NoError(t, app.Init(home, &struct{}{}))
+	assert.Equal(t, filepath.Join(home, pathEmbedded, "1.0.0"), app.EmbeddedPath)
+	assert.FileExists(t, filepath.Join(app.EmbeddedPath, "testdata/embedded/a.txt"))
+}
+
+func TestPreferRAMExtractRetention(t *testing.T) {
+	root := withRAMRoot(t)
+	private := filepath.Join(root, "test-"+strconv.Itoa(os.Getuid()))
+	assert.NoError(t, os.Mkdir(private, 0700))
+	for _, embeddedVersion := range []string{"0.1.0", "0.2.0", "0.3.0", "0.4.0"} {
+		assert.NoError(t, os.Mkdir(filepath.Join(private, embeddedVersion), 0755))
+	}
+
+	app := newTestApp()
+	app.PreferRAMExtract = true
+	result, err := app.InitWithResult(t.TempDir(), &struct{}{})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"0.1.0", "0.2.0"}, result.CleanedVersions)
+	versions, err := embeddedVersionsIn(private)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"0.3.0", "0.4.0", "1.0.0"}, versions)
+
+	_, err = app.Vacuum()
+	assert.NoError(t, err)
+	versions, err = embeddedVersionsIn(private)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1.0.0"}, versions)
+}
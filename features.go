@@ -0,0 +1,46 @@
+package app
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/n0rad/go-erlog/data"
+)
+
+// environ lists the environment scanned for feature flags, replaceable in tests
+var environ = os.Environ
+
+// Feature returns whether a feature flag is enabled, false when not set
+func (app *App) Feature(name string) bool {
+	return app.FeatureFlags[strings.ToLower(name)]
+}
+
+func (app *App) loadFeatureFlags() {
+	prefix := app.envPrefix() + "_FEATURE_"
+	for _, env := range environ() {
+		key, value, ok := strings.Cut(env, "=")
+		if !ok || !strings.HasPrefix(key, prefix) || len(key) == len(prefix) {
+			continue
+		}
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			app.logger().Warn(err, data.WithField("env", key).WithField("value", value), "Invalid feature flag value, ignoring")
+			continue
+		}
+		if app.FeatureFlags == nil {
+			app.FeatureFlags = map[string]bool{}
+		}
+		app.FeatureFlags[strings.ToLower(strings.TrimPrefix(key, prefix))] = enabled
+	}
+}
+
+// envPrefix is the app name as an environment variable prefix, like MY_APP for my-app
+func (app *App) envPrefix() string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == '.' {
+			return '_'
+		}
+		return r
+	}, strings.ToUpper(app.Name))
+}
@@ -0,0 +1,43 @@
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/n0rad/go-erlog/errs"
+	"gopkg.in/yaml.v3"
+)
+
+// Fingerprint returns a hash of Version, the loaded config and the embedded content,
+// changing whenever one of them does
+func (app *App) Fingerprint() (string, error) {
+	configHash, err := app.configContentHash()
+	if err != nil {
+		return "", err
+	}
+	var embeddedHash string
+	if app.Embedded != nil {
+		if embeddedHash, err = app.EmbeddedContentHash(); err != nil {
+			return "", err
+		}
+	}
+	sum := sha256.Sum256([]byte(app.Version + "\x00" + configHash + "\x00" + embeddedHash))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// configContentHash returns a sha256 of the in memory config, empty when no config is loaded
+func (app *App) configContentHash() (string, error) {
+	if app.config == nil {
+		return "", nil
+	}
+	node, err := configNode(app.config)
+	if err != nil {
+		return "", err
+	}
+	content, err := yaml.Marshal(node)
+	if err != nil {
+		return "", errs.WithE(err, "Failed to encode config")
+	}
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,135 @@
+package app
+
+import (
+	"errors"
+	"io/fs"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+)
+
+// pathEmbeddedIgnore is an optional gitignore style file at the root of the embedded FS, never extracted
+const pathEmbeddedIgnore = ".appignore"
+
+type ignoreRule struct {
+	pattern *regexp.Regexp
+	negate  bool
+	dirOnly bool
+	// basename rules, without slash, match the name of an entry at any depth
+	basename bool
+}
+
+type ignoreRules []ignoreRule
+
+// parseIgnore parses gitignore style patterns: globs with ** support, ! negation, trailing / for directories
+// and leading or inner / to anchor a pattern to the root
+func parseIgnore(content string) (ignoreRules, error) {
+	var rules ignoreRules
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule := ignoreRule{}
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\`) {
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+		rule.basename = !strings.Contains(line, "/")
+		line = strings.TrimPrefix(line, "/")
+
+		pattern, err := regexp.Compile("^" + globToRegexp(line) + "$")
+		if err != nil {
+			return nil, errs.WithEF(err, data.WithField("pattern", line), "Invalid ignore pattern")
+		}
+		rule.pattern = pattern
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func globToRegexp(glob string) string {
+	var re strings.Builder
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			if strings.HasPrefix(glob[i:], "**/") {
+				re.WriteString("(.*/)?")
+				i += 2
+			} else if strings.HasPrefix(glob[i:], "**") {
+				re.WriteString(".*")
+				i++
+			} else {
+				re.WriteString("[^/]*")
+			}
+		case '?':
+			re.WriteString("[^/]")
+		case '[':
+			if end := strings.IndexByte(glob[i:], ']'); end > 0 {
+				class := glob[i+1 : i+end]
+				if strings.HasPrefix(class, "!") {
+					class = "^" + class[1:]
+				}
+				re.WriteString("[" + class + "]")
+				i += end
+			} else {
+				re.WriteString(`\[`)
+			}
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return re.String()
+}
+
+// ignored tells whether an entry is ignored, the last matching rule winning
+func (rules ignoreRules) ignored(entryPath string, dir bool) bool {
+	ignored := false
+	for _, rule := range rules {
+		if rule.dirOnly && !dir {
+			continue
+		}
+		name := entryPath
+		if rule.basename {
+			name = path.Base(entryPath)
+		}
+		if rule.pattern.MatchString(name) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+// readEmbeddedIgnore returns the rules of the embedded .appignore, or nil if there is none
+func (app *App) readEmbeddedIgnore() (ignoreRules, error) {
+	content, err := fs.ReadFile(app.embeddedFS(), pathEmbeddedIgnore)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errs.WithE(err, "Failed to read embedded ignore file")
+	}
+	return parseIgnore(string(content))
+}
+
+// skippedIgnored tells whether an entry, or one of its directories, is ignored. As with git,
+// files of an ignored directory cannot be included back
+func (e *extraction) skippedIgnored(entry embeddedEntry) bool {
+	if e.ignore == nil {
+		return false
+	}
+	for dir := path.Dir(entry.path); dir != "."; dir = path.Dir(dir) {
+		if e.ignore.ignored(dir, true) {
+			return true
+		}
+	}
+	return e.ignore.ignored(entry.path, entry.dir)
+}
@@ -0,0 +1,23 @@
+package app
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIgnoreRules(t *testing.T) {
+	rules, err := parseIgnore("# comment\n*.log\n!keep.log\nbuild/\n/docs/*.md\n**/tmp/**\n")
+	assert.NoError(t, err)
+	e := &extraction{ignore: rules}
+
+	assert.True(t, e.skippedIgnored(embeddedEntry{path: "a/b/debug.log"}))
+	assert.False(t, e.skippedIgnored(embeddedEntry{path: "a/keep.log"}))
+	assert.True(t, e.skippedIgnored(embeddedEntry{path: "a/build", dir: true}))
+	assert.False(t, e.skippedIgnored(embeddedEntry{path: "a/build"}))
+	assert.True(t, e.skippedIgnored(embeddedEntry{path: "a/build/out.bin"}))
+	assert.True(t, e.skippedIgnored(embeddedEntry{path: "docs/readme.md"}))
+	assert.False(t, e.skippedIgnored(embeddedEntry{path: "a/docs/readme.md"}))
+	assert.True(t, e.skippedIgnored(embeddedEntry{path: "x/tmp/y/z.txt"}))
+	assert.False(t, e.skippedIgnored(embeddedEntry{path: "x/tmpl.txt"}))
+}
@@ -0,0 +1,74 @@
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/n0rad/go-erlog/data"
+)
+
+// previousExtraction returns an extracted tree with a manifest to reuse files from, the current one first,
+// then the one of the version recorded in home
+func (app *App) previousExtraction(homeVersion string) (string, Manifest) {
+	candidates := []string{app.EmbeddedPath}
+	if homeVersion != "" && homeVersion != app.Version {
+		candidates = append(candidates, filepath.Join(app.cacheHome(), pathEmbedded, homeVersion, app.EmbeddedChannel))
+	}
+	for _, root := range candidates {
+		if manifest, err := ReadManifest(filepath.Join(root, PathExtractedManifest)); err == nil {
+			return root, manifest
+		}
+	}
+	return "", nil
+}
+
+// reusePrevious hard links the file of the previous extraction at newPath when identical to the embedded one
+func (app *App) reusePrevious(e *extraction, path string, newPath string, mode fs.FileMode) (ManifestEntry, bool) {
+	previous, ok := e.previous[filepath.ToSlash(path)]
+	if !ok || previous.Mode != mode {
+		return previous, false
+	}
+	if _, routed := e.routedPath(path); routed {
+		return previous, false
+	}
+	rel, ok := e.channelPath(path)
+	if !ok {
+		return previous, false
+	}
+
+	sum, size, err := hashEmbeddedFile(app.embeddedFS(), path)
+	if err != nil || sum != previous.Sha256 || size != previous.Size {
+		return previous, false
+	}
+	if e.verify != nil && e.verify[filepath.ToSlash(path)].Sha256 != sum {
+		return previous, false
+	}
+	// the previous file may have been modified since its manifest was written
+	previousPath := filepath.Join(e.previousRoot, rel)
+	if onDisk, _, err := hashFile(previousPath); err != nil || onDisk != sum {
+		return previous, false
+	}
+	if err := os.Link(previousPath, newPath); err != nil {
+		app.logger().Debug(err, data.WithField("path", previousPath), "Failed to link previously extracted file, extracting it")
+		return previous, false
+	}
+	return previous, true
+}
+
+func hashEmbeddedFile(fsys fs.FS, path string) (string, int64, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	size, err := io.Copy(hash, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), size, nil
+}
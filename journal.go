@@ -0,0 +1,127 @@
+package app
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+)
+
+const pathJournal = "extract.journal"
+const journalVersionPrefix = "version "
+
+// extractJournal records each fully extracted file as a "sha256 size path" line,
+// so a restarted extraction can skip what was already written.
+// Lines are in completion order, which varies with ExtractConcurrency, unlike the written manifests
+type extractJournal struct {
+	path    string
+	file    *os.File
+	done    map[string]ManifestEntry
+	resumed bool
+}
+
+func openExtractJournal(path string, version string, logger Logger) (*extractJournal, error) {
+	journal := &extractJournal{path: path, done: map[string]ManifestEntry{}}
+	if err := journal.load(version); err != nil {
+		logger.Warn(err, data.WithField("path", path), "Ignoring unreadable extraction journal")
+		journal.done = map[string]ManifestEntry{}
+		journal.resumed = false
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	if !journal.resumed {
+		flags |= os.O_TRUNC
+	}
+	file, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return nil, errs.WithEF(err, data.WithField("path", path), "Failed to open extraction journal")
+	}
+	journal.file = file
+
+	if !journal.resumed {
+		if _, err := file.WriteString(journalVersionPrefix + version + "\n"); err != nil {
+			file.Close()
+			return nil, errs.WithEF(err, data.WithField("path", path), "Failed to write extraction journal")
+		}
+	}
+	return journal, nil
+}
+
+func (j *extractJournal) load(version string) error {
+	file, err := os.Open(j.path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	if !scanner.Scan() || scanner.Text() != journalVersionPrefix+version {
+		return scanner.Err()
+	}
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), " ", 3)
+		if len(fields) != 3 {
+			// last line may be truncated by the interruption
+			continue
+		}
+		size, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		j.done[fields[2]] = ManifestEntry{Sha256: fields[0], Size: size}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	j.resumed = true
+	return nil
+}
+
+func (j *extractJournal) completed(path string, target string) (ManifestEntry, bool) {
+	entry, ok := j.done[filepath.ToSlash(path)]
+	if !ok {
+		return entry, false
+	}
+	info, err := os.Stat(target)
+	if err != nil || info.Size() != entry.Size {
+		return entry, false
+	}
+	sum, _, err := hashFile(target)
+	if err != nil || sum != entry.Sha256 {
+		return entry, false
+	}
+	entry.Mode = info.Mode().Perm()
+	return entry, true
+}
+
+func (j *extractJournal) record(path string, entry ManifestEntry) error {
+	if _, err := fmt.Fprintf(j.file, "%s %d %s\n", entry.Sha256, entry.Size, filepath.ToSlash(path)); err != nil {
+		return errs.WithEF(err, data.WithField("path", j.path), "Failed to write extraction journal")
+	}
+	return j.file.Sync()
+}
+
+// Complete removes the journal once extraction fully succeeded
+func (j *extractJournal) Complete() error {
+	j.Close()
+	if err := os.Remove(j.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (j *extractJournal) Close() error {
+	if j.file == nil {
+		return nil
+	}
+	err := j.file.Close()
+	j.file = nil
+	return err
+}
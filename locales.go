@@ -0,0 +1,36 @@
+package app
+
+import (
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/n0rad/go-erlog/data"
+)
+
+// excludedLocale tells whether an embedded entry belongs to a locale subdirectory of localeDir not in locales
+func (e *extraction) excludedLocale(entry embeddedEntry) bool {
+	if e.localeDir == "" || len(e.locales) == 0 {
+		return false
+	}
+	rel, ok := strings.CutPrefix(entry.path, e.localeDir+"/")
+	if !ok {
+		return false
+	}
+	locale, _, nested := strings.Cut(rel, "/")
+	if !nested && !entry.dir {
+		return false
+	}
+	return !slices.Contains(e.locales, locale)
+}
+
+// warnMissingLocales logs the requested locales the embedded locale dir does not hold
+func (app *App) warnMissingLocales() {
+	for _, locale := range app.Locales {
+		localePath := path.Join(strings.Trim(app.EmbeddedLocaleDir, "/"), locale)
+		if stat, err := fs.Stat(app.embeddedFS(), localePath); err != nil || !stat.IsDir() {
+			app.logger().Warn(nil, data.WithField("locale", locale).WithField("path", localePath), "Requested locale is not embedded")
+		}
+	}
+}
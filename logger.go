@@ -0,0 +1,40 @@
+package app
+
+import (
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/logs"
+)
+
+// Logger receives what Init and cleanup log, err and fields being nil when there are none
+type Logger interface {
+	Debug(err error, fields data.Fields, msg string)
+	Info(err error, fields data.Fields, msg string)
+	Warn(err error, fields data.Fields, msg string)
+	Error(err error, fields data.Fields, msg string)
+}
+
+// erlogLogger logs to the go-erlog global logger
+type erlogLogger struct{}
+
+func (erlogLogger) Debug(err error, fields data.Fields, msg string) {
+	logs.WithEF(err, fields).Debug(msg)
+}
+
+func (erlogLogger) Info(err error, fields data.Fields, msg string) {
+	logs.WithEF(err, fields).Info(msg)
+}
+
+func (erlogLogger) Warn(err error, fields data.Fields, msg string) {
+	logs.WithEF(err, fields).Warn(msg)
+}
+
+func (erlogLogger) Error(err error, fields data.Fields, msg string) {
+	logs.WithEF(err, fields).Error(msg)
+}
+
+func (app *App) logger() Logger {
+	if app.Logger != nil {
+		return app.Logger
+	}
+	return erlogLogger{}
+}
@@ -0,0 +1,63 @@
+package app
+
+import (
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+)
+
+const pathManifest = "manifest.json"
+
+type ManifestEntry struct {
+	Size   int64       `json:"size"`
+	Mode   fs.FileMode `json:"mode"`
+	Sha256 string      `json:"sha256"`
+	// ModTime is the build time unix modification time, only set in the embedded manifest
+	ModTime int64 `json:"modTime,omitempty"`
+}
+
+// Manifest maps each extracted path, relative to the extraction root, to its content description
+type Manifest map[string]ManifestEntry
+
+// Write writes the manifest as indented json, identical for the same content whatever the extraction order
+// as encoding/json sorts map keys
+func (m Manifest) Write(path string) error {
+	bytes, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return errs.WithE(err, "Failed to marshal manifest")
+	}
+	if err := os.WriteFile(path, append(bytes, '\n'), 0644); err != nil {
+		return errs.WithEF(err, data.WithField("path", path), "Failed to write manifest")
+	}
+	return nil
+}
+
+func ReadManifest(path string) (Manifest, error) {
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errs.WithEF(err, data.WithField("path", path), "Failed to read manifest")
+	}
+	manifest := Manifest{}
+	if err := json.Unmarshal(bytes, &manifest); err != nil {
+		return nil, errs.WithEF(err, data.WithField("path", path), "Failed to parse manifest")
+	}
+	return manifest, nil
+}
+
+// unchangedOnDisk reports whether target exists with the modification time recorded for path
+func (m Manifest) unchangedOnDisk(path string, target string) (ManifestEntry, bool) {
+	entry, ok := m[filepath.ToSlash(path)]
+	if !ok || entry.ModTime == 0 {
+		return entry, false
+	}
+	info, err := os.Stat(target)
+	if err != nil || !info.Mode().IsRegular() || info.ModTime().Unix() != entry.ModTime {
+		return entry, false
+	}
+	entry.Mode = info.Mode().Perm()
+	return entry, true
+}
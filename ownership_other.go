@@ -0,0 +1,21 @@
+//go:build !unix
+
+package app
+
+import "os"
+
+func verifyOwnership(home string) error {
+	return nil
+}
+
+func copyOwnership(path string, info os.FileInfo) error {
+	return nil
+}
+
+func ensurePrivateDir(path string) error {
+	return os.MkdirAll(path, 0700)
+}
+
+func verifyPrivateDir(path string) error {
+	return nil
+}
@@ -0,0 +1,78 @@
+//go:build unix
+
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+)
+
+func verifyOwnership(home string) error {
+	uid := os.Getuid()
+	paths := []string{home}
+	entries, err := os.ReadDir(home)
+	if err != nil {
+		return errs.WithEF(err, data.WithField("path", home), "Failed to read home directory")
+	}
+	for _, entry := range entries {
+		paths = append(paths, filepath.Join(home, entry.Name()))
+	}
+
+	for _, path := range paths {
+		info, err := os.Lstat(path)
+		if err != nil {
+			return errs.WithEF(err, data.WithField("path", path), "Failed to stat home content")
+		}
+		stat, ok := info.Sys().(*syscall.Stat_t)
+		if !ok {
+			continue
+		}
+		if int(stat.Uid) != uid {
+			return errs.WithF(data.WithField("path", path).WithField("owner", stat.Uid).WithField("uid", uid), "Home content is owned by another user")
+		}
+	}
+	return nil
+}
+
+// copyOwnership gives path the owner and group of info, best effort as only root can give files away
+func copyOwnership(path string, info os.FileInfo) error {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	if err := os.Lchown(path, int(stat.Uid), int(stat.Gid)); err != nil {
+		return errs.WithEF(err, data.WithField("path", path).WithField("uid", stat.Uid).WithField("gid", stat.Gid), "Failed to copy ownership")
+	}
+	return nil
+}
+
+// ensurePrivateDir creates a directory only accessible by the current user, or checks an existing one is
+func ensurePrivateDir(path string) error {
+	if err := os.Mkdir(path, 0700); err != nil && !os.IsExist(err) {
+		return errs.WithEF(err, data.WithField("path", path), "Failed to create private directory")
+	}
+	return verifyPrivateDir(path)
+}
+
+// verifyPrivateDir checks path is a directory, not a symlink, owned by and only accessible to the current user
+func verifyPrivateDir(path string) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return errs.WithEF(err, data.WithField("path", path), "Failed to stat private directory")
+	}
+	if !info.IsDir() {
+		return errs.WithF(data.WithField("path", path), "Private directory is not a directory")
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return errs.WithF(data.WithField("path", path), "Cannot read private directory owner")
+	}
+	if int(stat.Uid) != os.Getuid() || info.Mode().Perm() != 0700 {
+		return errs.WithF(data.WithField("path", path).WithField("owner", stat.Uid).WithField("mode", info.Mode().Perm()), "Private directory is owned or accessible by another user")
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+)
+
+// pathPids holds, per extracted embedded directory name, the pids of processes initialized on it
+const pathPids = "pids"
+
+// safeReextractWait bounds the wait for processes using an embedded directory to exit, replaceable in tests
+var safeReextractWait = 5 * time.Second
+
+func (app *App) pidsPath(embeddedDir string) string {
+	return filepath.Join(app.cacheHome(), pathPids, embeddedDir)
+}
+
+// livePids returns the other live processes registered on an embedded directory
+func (app *App) livePids(embeddedDir string) ([]int, error) {
+	content, err := os.ReadFile(app.pidsPath(embeddedDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errs.WithEF(err, data.WithField("path", app.pidsPath(embeddedDir)), "Failed to read pids file")
+	}
+	var pids []int
+	for _, line := range strings.Fields(string(content)) {
+		pid, err := strconv.Atoi(line)
+		if err != nil || pid == os.Getpid() || !processAlive(pid) {
+			continue
+		}
+		pids = append(pids, pid)
+	}
+	return pids, nil
+}
+
+// registerPid records the current process on an embedded directory, dropping exited ones
+func (app *App) registerPid(embeddedDir string) error {
+	pids, err := app.livePids(embeddedDir)
+	if err != nil {
+		return err
+	}
+	pids = append(pids, os.Getpid())
+
+	var content strings.Builder
+	for _, pid := range pids {
+		content.WriteString(strconv.Itoa(pid) + "\n")
+	}
+	if err := os.MkdirAll(filepath.Join(app.cacheHome(), pathPids), 0755); err != nil {
+		return errs.WithE(err, "Failed to create pids directory")
+	}
+	if err := os.WriteFile(app.pidsPath(embeddedDir), []byte(content.String()), 0644); err != nil {
+		return errs.WithEF(err, data.WithField("path", app.pidsPath(embeddedDir)), "Failed to write pids file")
+	}
+	return nil
+}
+
+// waitEmbeddedUnused waits, up to safeReextractWait, for other processes registered on an embedded directory to exit
+func (app *App) waitEmbeddedUnused(embeddedDir string) bool {
+	deadline := time.Now().Add(safeReextractWait)
+	for {
+		pids, err := app.livePids(embeddedDir)
+		if err != nil {
+			app.logger().Warn(err, nil, "Cannot check processes using embedded, considering it used")
+		} else if len(pids) == 0 {
+			return true
+		}
+		if !time.Now().Before(deadline) {
+			app.logger().Warn(nil, data.WithField("dir", embeddedDir).WithField("pids", pids), "Embedded still used by other processes")
+			return false
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !unix
+
+package app
+
+import "os"
+
+// processAlive on windows relies on FindProcess opening a handle of the process
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release()
+	return true
+}
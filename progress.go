@@ -0,0 +1,49 @@
+package app
+
+import (
+	"fmt"
+	"io"
+)
+
+type extractProgress struct {
+	writer   io.Writer
+	callback func(done, total int, path string)
+	total    int
+	done     int
+}
+
+// countToExtract returns how many embedded files the extraction will write
+func (e *extraction) countToExtract() int {
+	count := 0
+	for _, entry := range e.entries {
+		if !entry.regular || controlFile(entry.path) {
+			continue
+		}
+		if e.excludedLocale(entry) || e.skippedConditional(entry.path) || e.skippedIgnored(entry) {
+			continue
+		}
+		if _, ok := e.channelPath(entry.path); !ok {
+			continue
+		}
+		count++
+	}
+	return count
+}
+
+func (e *extraction) reportProgress(path string) {
+	if (e.progress.writer == nil && e.progress.callback == nil) || controlFile(path) {
+		return
+	}
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.progress.total == 0 {
+		e.progress.total = e.countToExtract()
+	}
+	e.progress.done++
+	if e.progress.writer != nil {
+		fmt.Fprintf(e.progress.writer, "extracted %s (%d/%d)\n", path, e.progress.done, e.progress.total)
+	}
+	if e.progress.callback != nil {
+		e.progress.callback(e.progress.done, e.progress.total, path)
+	}
+}
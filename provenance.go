@@ -0,0 +1,39 @@
+package app
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/n0rad/go-app/version"
+	"github.com/n0rad/go-erlog/data"
+)
+
+const (
+	xattrVersion     = "user.app.version"
+	xattrExtractedAt = "user.app.extracted_at"
+)
+
+// provenance records on each written file the version that extracted it and when, as extended attributes
+type provenance struct {
+	version     string
+	logger      Logger
+	unsupported atomic.Bool
+}
+
+func (p *provenance) record(path string) {
+	if p.unsupported.Load() {
+		return
+	}
+	for _, xattr := range [][2]string{
+		{xattrVersion, p.version},
+		{xattrExtractedAt, version.Now().UTC().Format(time.RFC3339)},
+	} {
+		if err := setXattr(path, xattr[0], xattr[1]); err != nil {
+			// the filesystem or platform has no extended attributes, no need to try again for each file
+			if !p.unsupported.Swap(true) {
+				p.logger.Warn(err, data.WithField("path", path), "Failed to write provenance extended attributes, skipping them")
+			}
+			return
+		}
+	}
+}
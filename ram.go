@@ -0,0 +1,101 @@
+package app
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+
+	"github.com/n0rad/go-erlog/data"
+)
+
+// ramRoot is the RAM backed directory embedded is preferably extracted to, replaceable in tests
+var ramRoot = "/dev/shm"
+
+// resolveEmbeddedPath returns where embedded is extracted, in RAM when preferred and possible
+func (app *App) resolveEmbeddedPath() string {
+	return app.embeddedPathWith(ensurePrivateDir)
+}
+
+// planEmbeddedPath resolves like resolveEmbeddedPath without creating the RAM embedded root
+func (app *App) planEmbeddedPath() string {
+	return app.embeddedPathWith(func(root string) error {
+		if _, err := os.Lstat(root); os.IsNotExist(err) {
+			return nil
+		}
+		return verifyPrivateDir(root)
+	})
+}
+
+func (app *App) embeddedPathWith(privateRoot func(root string) error) string {
+	homePath := app.homeEmbeddedPath()
+	if !app.PreferRAMExtract || runtime.GOOS != "linux" {
+		return homePath
+	}
+	if stat, err := os.Stat(ramRoot); err != nil || !stat.IsDir() {
+		app.logger().Debug(nil, data.WithField("path", ramRoot), "No RAM backed directory, extracting to home")
+		return homePath
+	}
+
+	// the RAM backed directory is world writable, only a directory of our own that nobody else can write is trusted
+	root := app.ramEmbeddedRoot()
+	if err := privateRoot(root); err != nil {
+		app.logger().Warn(err, data.WithField("path", root), "RAM backed directory cannot be trusted, extracting to home")
+		return homePath
+	}
+	ramPath := filepath.Join(root, app.Version, app.EmbeddedChannel)
+	if _, err := os.Stat(ramPath); err == nil {
+		return ramPath
+	}
+
+	size, err := app.embeddedSize()
+	if err != nil {
+		app.logger().Warn(err, nil, "Failed to compute embedded size, extracting to home")
+		return homePath
+	}
+	free, ok, err := freeBytes(ramRoot)
+	if err != nil || !ok || free < size {
+		app.logger().Warn(err, data.WithField("free", free).WithField("needed", size), "Not enough RAM backed space, extracting to home")
+		return homePath
+	}
+	return ramPath
+}
+
+// ramEmbeddedRoot is the directory of the user holding the embedded versions extracted in RAM
+func (app *App) ramEmbeddedRoot() string {
+	return filepath.Join(ramRoot, app.Name+"-"+strconv.Itoa(os.Getuid()))
+}
+
+// trustedRAMRoot returns the RAM embedded root when it exists and is private, for cleanup
+func (app *App) trustedRAMRoot() (string, bool) {
+	root := app.ramEmbeddedRoot()
+	if _, err := os.Lstat(root); err != nil {
+		return "", false
+	}
+	if err := verifyPrivateDir(root); err != nil {
+		app.logger().Warn(err, data.WithField("path", root), "RAM backed directory cannot be trusted, skipping its cleanup")
+		return "", false
+	}
+	return root, true
+}
+
+func (app *App) homeEmbeddedPath() string {
+	return filepath.Join(app.cacheHome(), pathEmbedded, app.Version, app.EmbeddedChannel)
+}
+
+func (app *App) embeddedSize() (uint64, error) {
+	var size uint64
+	err := fs.WalkDir(app.embeddedFS(), ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += uint64(info.Size())
+		return nil
+	})
+	return size, err
+}
@@ -0,0 +1,49 @@
+package app
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// makeTreeReadOnly removes the write bits of the directories of an extracted tree, files are made read only when written
+func makeTreeReadOnly(root string) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return os.Chmod(path, 0555)
+		}
+		return nil
+	})
+}
+
+// makeTreeWritable gives back the owner write bit to the directories of an extracted tree, a missing tree is ignored
+func makeTreeWritable(root string) error {
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return os.Chmod(path, 0755)
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// removeTree removes an extracted tree, even when extracted read only
+func removeTree(path string) error {
+	err := os.RemoveAll(path)
+	if err == nil {
+		return nil
+	}
+	if err := makeTreeWritable(path); err != nil {
+		return err
+	}
+	return os.RemoveAll(path)
+}
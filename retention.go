@@ -0,0 +1,45 @@
+package app
+
+// Multiple process could be running in parallel and there is no way to know if we can clean up embedded without monitoring process.
+// To not do process monitoring, we can assume the app will not be updated more than 2 times without having process completed
+// So we keep by default 2 embedded + one being installed
+const defaultRetainedEmbeddedVersions = 3
+
+// RetentionPolicy selects the extracted embedded versions removed by cleanup
+type RetentionPolicy interface {
+	// ToRemove receives extracted versions sorted oldest first and the version currently running
+	ToRemove(sortedVersions []string, current string) []string
+}
+
+// KeepTotal keeps the Count newest versions, and the current one
+type KeepTotal struct {
+	Count int
+}
+
+func (p KeepTotal) ToRemove(sortedVersions []string, current string) []string {
+	var toRemove []string
+	for i := 0; i < len(sortedVersions)-p.Count; i++ {
+		if sortedVersions[i] != current {
+			toRemove = append(toRemove, sortedVersions[i])
+		}
+	}
+	return toRemove
+}
+
+// KeepCurrentAndNewest keeps the current version plus the Count newest other versions, for rollback
+type KeepCurrentAndNewest struct {
+	Count int
+}
+
+func (p KeepCurrentAndNewest) ToRemove(sortedVersions []string, current string) []string {
+	var others []string
+	for _, v := range sortedVersions {
+		if v != current {
+			others = append(others, v)
+		}
+	}
+	if len(others) <= p.Count {
+		return nil
+	}
+	return others[:len(others)-p.Count]
+}
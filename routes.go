@@ -0,0 +1,80 @@
+package app
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+)
+
+// ExtractRoute places embedded files matching Match directly in Destination, relative to Home
+type ExtractRoute struct {
+	// Match is a path.Match pattern of the embedded path, or of the file name only when it has no slash, like *.sh
+	Match string
+	// Destination is the directory relative to Home receiving matching files, like bin. It must stay in Home
+	// and not be, nor place a file at, an entry managed by the App like embedded, version or config.yaml
+	Destination string
+}
+
+func (r ExtractRoute) matches(embeddedPath string) bool {
+	name := embeddedPath
+	if !strings.Contains(r.Match, "/") {
+		name = path.Base(embeddedPath)
+	}
+	ok, _ := path.Match(r.Match, name)
+	return ok
+}
+
+// routedPath returns where the first matching route places an embedded file, or false when none matches
+func (e *extraction) routedPath(embeddedPath string) (string, bool) {
+	for _, route := range e.routes {
+		if route.matches(embeddedPath) {
+			return filepath.Join(e.home, route.Destination, path.Base(embeddedPath)), true
+		}
+	}
+	return "", false
+}
+
+// checkExtractRoutes fails on a route with an invalid pattern, a destination outside of Home, empty being Home itself,
+// or inside an entry managed by the App
+func (app *App) checkExtractRoutes() error {
+	for _, route := range app.ExtractRoutes {
+		if _, err := path.Match(route.Match, ""); err != nil {
+			return errs.WithEF(err, data.WithField("match", route.Match), "Invalid extract route pattern")
+		}
+		if route.Destination != "" && !filepath.IsLocal(route.Destination) {
+			return errs.WithF(data.WithField("match", route.Match).WithField("destination", route.Destination), "Extract route destination must be relative to home")
+		}
+		if first, _, _ := strings.Cut(filepath.ToSlash(filepath.Clean(route.Destination)), "/"); reservedHomeEntry(first) {
+			return errs.WithF(data.WithField("match", route.Match).WithField("destination", route.Destination), "Extract route destination is managed by the app")
+		}
+	}
+	return nil
+}
+
+// reservedHomeEntry tells whether name, at the root of Home, is managed by the App and must not receive routed files
+func reservedHomeEntry(name string) bool {
+	switch name {
+	case pathEmbedded, pathLock, pathVersion, pathPrepared, pathManifest, pathPids, pathJournal:
+		return true
+	}
+	return strings.HasPrefix(name, pathConfigName+".")
+}
+
+// claimRoutedPath fails when another embedded file was already routed to routedPath, as they share a name,
+// or when routedPath is an entry managed by the App at the root of Home
+func (e *extraction) claimRoutedPath(embeddedPath string, routedPath string) error {
+	if filepath.Dir(routedPath) == filepath.Clean(e.home) && reservedHomeEntry(filepath.Base(routedPath)) {
+		return errs.WithF(data.WithField("path", embeddedPath).WithField("routed", routedPath), "Embedded file is routed to a path managed by the app")
+	}
+	if e.routed == nil {
+		e.routed = map[string]string{}
+	}
+	if other, ok := e.routed[routedPath]; ok && other != embeddedPath {
+		return errs.WithF(data.WithField("path", embeddedPath).WithField("other", other).WithField("routed", routedPath), "Embedded files are routed to the same path")
+	}
+	e.routed[routedPath] = embeddedPath
+	return nil
+}
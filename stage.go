@@ -0,0 +1,125 @@
+package app
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+)
+
+// StageAndActivate extracts the embedded of newApp next to the current one, verifies it and makes it
+// the active embedded and recorded version, under the home lock. The previous tree is left in place
+// so in flight reads complete, and is cleaned up later following the retention policy.
+// newApp extraction options apply, extracting under the homes of the App
+func (app *App) StageAndActivate(newApp *App) error {
+	if newApp.Embedded == nil {
+		return errs.With("New app has no embedded to stage")
+	}
+	if err := app.versionParser().Validate(newApp.Version); err != nil {
+		return errs.WithEF(err, data.WithField("version", newApp.Version), "Invalid version to stage")
+	}
+	if err := newApp.checkEmbeddedRoots(); err != nil {
+		return err
+	}
+
+	state := &initState{ctx: context.Background()}
+	if err := app.acquireLocks(state); err != nil {
+		return err
+	}
+	defer state.release(app.logger())
+
+	newApp.Home, newApp.CacheHome = app.Home, app.CacheHome
+	target := newApp.homeEmbeddedPath()
+	extraction, err := newApp.newExtraction(nil, target)
+	if err != nil {
+		return err
+	}
+	extraction.stage(target)
+	staging := extraction.target
+	if err := os.RemoveAll(staging); err != nil {
+		return errs.WithEF(err, data.WithField("path", staging), "Failed to cleanup staging embedded")
+	}
+	if err := newApp.extractEmbedded(extraction); err != nil {
+		_ = removeTree(staging)
+		return errs.WithEF(err, data.WithField("path", staging), "Failed to stage embedded")
+	}
+	if err := verifyExtracted(extraction); err != nil {
+		_ = removeTree(staging)
+		return err
+	}
+	if err := extraction.manifest.Write(filepath.Join(staging, PathExtractedManifest)); err != nil {
+		_ = removeTree(staging)
+		return err
+	}
+	if extraction.readOnly {
+		if err := makeTreeReadOnly(staging); err != nil {
+			_ = removeTree(staging)
+			return errs.WithEF(err, data.WithField("path", staging), "Failed to make staged embedded read only")
+		}
+	}
+
+	// the active tree of a restaged version is moved aside, as a rename does not replace a non empty directory
+	var replaced string
+	if target == app.activeEmbeddedPath() {
+		replaced = target + ".tmp-replaced-" + strconv.Itoa(os.Getpid())
+		if err := os.Rename(target, replaced); err != nil && !os.IsNotExist(err) {
+			_ = removeTree(staging)
+			return errs.WithEF(err, data.WithField("path", target), "Failed to move aside active embedded of staged version")
+		}
+	} else if err := removeTree(target); err != nil {
+		_ = removeTree(staging)
+		return errs.WithEF(err, data.WithField("path", target), "Failed to replace previous embedded of staged version")
+	}
+	if err := os.Rename(staging, target); err != nil {
+		_ = removeTree(staging)
+		if replaced != "" {
+			_ = os.Rename(replaced, target)
+		}
+		return errs.WithEF(err, data.WithField("path", target), "Failed to activate staged embedded")
+	}
+	if replaced != "" {
+		if err := removeTree(replaced); err != nil {
+			app.logger().Warn(err, data.WithField("path", replaced), "Failed to remove replaced embedded")
+		}
+	}
+
+	app.embeddedMutex.Lock()
+	app.Embedded = newApp.Embedded
+	app.EmbeddedPrefix = newApp.EmbeddedPrefix
+	app.EmbeddedChannel = newApp.EmbeddedChannel
+	app.Version = newApp.Version
+	app.EmbeddedPath = target
+	app.contentHash = nil
+	app.embeddedMutex.Unlock()
+
+	if err := app.writeHomeVersion(); err != nil {
+		return errs.WithE(err, "Failed to write current "+app.Name+" version to home")
+	}
+	app.logger().Info(nil, data.WithField("version", app.Version).WithField("path", target), "Activated staged embedded")
+
+	if _, err := app.cleanupEmbedded(); err != nil {
+		app.logger().Warn(err, nil, "Problem during embedded cleanup")
+	}
+	return nil
+}
+
+// verifyExtracted checks every file of the extraction manifest exists with its size where it was extracted
+func verifyExtracted(e *extraction) error {
+	for path, entry := range e.manifest {
+		fullPath, ok := e.filePath(path)
+		if !ok {
+			return errs.WithF(data.WithField("path", path), "Extracted embedded file is outside of the channel")
+		}
+		info, err := os.Stat(fullPath)
+		if err != nil {
+			return errs.WithEF(err, data.WithField("path", fullPath), "Extracted embedded is incomplete")
+		}
+		if info.Size() != entry.Size {
+			return errs.WithF(data.WithField("path", fullPath).WithField("size", info.Size()).WithField("expected", entry.Size), "Extracted embedded file has unexpected size")
+		}
+	}
+	return nil
+}
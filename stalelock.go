@@ -0,0 +1,91 @@
+package app
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofrs/flock"
+	"github.com/n0rad/go-erlog/data"
+)
+
+// staleLockCheckInterval is how long the home lock is waited for before checking its owner is alive, replaceable in tests
+var staleLockCheckInterval = time.Second
+
+// lockHome takes the home lock and records the current process as its owner. With ReclaimStaleLock,
+// a lock whose recorded owner is gone, held by a process it left behind, is replaced by a new lock file
+func (app *App) lockHome(ctx context.Context, path string) (*flock.Flock, error) {
+	for {
+		lock := flock.New(path)
+		var err error
+		timedOut := false
+		if app.ReclaimStaleLock {
+			attemptCtx, cancel := context.WithTimeout(ctx, staleLockCheckInterval)
+			err = lockContext(attemptCtx, lock)
+			timedOut = attemptCtx.Err() != nil
+			cancel()
+		} else {
+			err = lockContext(ctx, lock)
+		}
+		if err == nil {
+			// a reclaim replaced the file while waiting for it, its lock protects nothing anymore
+			if !lockedCurrentFile(lock) {
+				_ = lock.Unlock()
+				continue
+			}
+			if err := os.WriteFile(path, []byte(strconv.Itoa(os.Getpid())), 0644); err != nil {
+				app.logger().Warn(err, data.WithField("path", path), "Failed to record lock owner")
+			}
+			return lock, nil
+		}
+		if !app.ReclaimStaleLock || ctx.Err() != nil || !timedOut {
+			return nil, err
+		}
+
+		app.reclaimStaleLock(path)
+	}
+}
+
+// reclaimStaleLock removes the lock file when its recorded owner is gone, so the next attempt locks a new one
+func (app *App) reclaimStaleLock(path string) {
+	before, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	pid, ok := lockOwner(path)
+	if !ok || processAlive(pid) {
+		return
+	}
+	// another process may have reclaimed it since the owner was read
+	if after, err := os.Stat(path); err != nil || !os.SameFile(before, after) {
+		return
+	}
+	app.logger().Warn(nil, data.WithField("path", path).WithField("pid", pid), "Home lock owner is gone, reclaiming stale lock")
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		app.logger().Warn(err, data.WithField("path", path), "Failed to remove stale lock")
+	}
+}
+
+// lockedCurrentFile tells whether the locked file is still the one at the lock path
+func lockedCurrentFile(lock *flock.Flock) bool {
+	locked, err := lock.Stat()
+	if err != nil {
+		return false
+	}
+	current, err := os.Stat(lock.Path())
+	return err == nil && os.SameFile(locked, current)
+}
+
+func lockOwner(path string) (int, bool) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return 0, false
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	if err != nil || pid <= 0 || pid == os.Getpid() {
+		return 0, false
+	}
+	return pid, true
+}
@@ -0,0 +1,133 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+)
+
+type Status struct {
+	Version          string
+	HomeVersion      string
+	EmbeddedVersions []string
+	EmbeddedPath     string
+	EmbeddedComplete bool
+	// Problems lists detected inconsistencies between the running, recorded and extracted versions
+	Problems []string
+}
+
+// StatusReport aggregates the running version, the version recorded in home and the embedded versions extracted
+// in home or in RAM
+func (app *App) StatusReport() (Status, error) {
+	status := Status{
+		Version:      app.Version,
+		EmbeddedPath: app.EmbeddedPath,
+	}
+
+	homeVersion, err := app.readHomeVersion()
+	if err != nil && !os.IsNotExist(err) {
+		return status, errs.WithEF(err, data.WithField("path", filepath.Join(app.dataHome(), pathVersion)), "Failed to read home version")
+	}
+	status.HomeVersion = homeVersion
+	if status.HomeVersion == "" {
+		status.Problems = append(status.Problems, "no version recorded in home")
+	} else if status.HomeVersion != app.Version {
+		status.Problems = append(status.Problems, "recorded version "+status.HomeVersion+" differs from running version "+app.Version)
+	}
+
+	if app.Embedded == nil {
+		return status, nil
+	}
+
+	if _, err := os.Stat(filepath.Join(app.cacheHome(), pathEmbedded)); err == nil {
+		if status.EmbeddedVersions, err = app.EmbeddedVersions(); err != nil {
+			return status, err
+		}
+	}
+	if root, ok := app.trustedRAMRoot(); ok {
+		ramVersions, err := embeddedVersionsIn(root)
+		if err != nil {
+			return status, err
+		}
+		for _, ramVersion := range ramVersions {
+			if !slices.Contains(status.EmbeddedVersions, ramVersion) {
+				status.EmbeddedVersions = append(status.EmbeddedVersions, ramVersion)
+			}
+		}
+	}
+
+	if status.HomeVersion != "" && !slices.Contains(status.EmbeddedVersions, status.HomeVersion) {
+		status.Problems = append(status.Problems, "recorded version "+status.HomeVersion+" has no extracted tree")
+	}
+
+	status.EmbeddedComplete = app.embeddedComplete()
+	if !status.EmbeddedComplete {
+		status.Problems = append(status.Problems, "embedded path is not completely extracted")
+	}
+	return status, nil
+}
+
+func (app *App) embeddedComplete() bool {
+	if app.EmbeddedPath == "" {
+		return false
+	}
+	if stat, err := os.Stat(app.EmbeddedPath); err != nil || !stat.IsDir() {
+		return false
+	}
+	if _, err := os.Stat(filepath.Join(app.cacheHome(), pathJournal)); err == nil {
+		return false
+	}
+	return true
+}
+
+// ExtractionInProgress reports whether another live process is extracting embedded, from its staging directory
+// or from a journal left while the recorded lock owner is alive. It reads markers without taking the lock,
+// so it is a best effort snapshot that can be outdated as soon as it returns
+func (app *App) ExtractionInProgress() (bool, error) {
+	embeddedRoot := filepath.Join(app.cacheHome(), pathEmbedded)
+	versions, err := os.ReadDir(embeddedRoot)
+	if err != nil && !os.IsNotExist(err) {
+		return false, errs.WithEF(err, data.WithField("path", embeddedRoot), "Failed to read embedded directory")
+	}
+	for _, version := range versions {
+		if stagingAlive(version.Name()) {
+			return true, nil
+		}
+		if !version.IsDir() {
+			continue
+		}
+		// channels are staged inside their version directory
+		channels, err := os.ReadDir(filepath.Join(embeddedRoot, version.Name()))
+		if err != nil {
+			continue
+		}
+		for _, channel := range channels {
+			if stagingAlive(channel.Name()) {
+				return true, nil
+			}
+		}
+	}
+
+	// resumable extractions write in place, next to their journal
+	if _, err := os.Stat(filepath.Join(app.cacheHome(), pathJournal)); err == nil {
+		if pid, ok := lockOwner(filepath.Join(app.Home, pathLock)); ok && processAlive(pid) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// stagingAlive reports whether a name is a staging directory of another live process
+func stagingAlive(name string) bool {
+	index := strings.LastIndex(name, ".tmp-")
+	if index < 0 {
+		return false
+	}
+	pid, err := strconv.Atoi(name[index+len(".tmp-"):])
+	return err == nil && pid > 0 && pid != os.Getpid() && processAlive(pid)
+}
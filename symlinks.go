@@ -0,0 +1,131 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+)
+
+// pathEmbeddedSymlinks is an optional json object at the root of the embedded FS, never extracted, mapping embedded
+// paths to the relative target of the symlink created there once files are extracted, as embed cannot hold symlinks
+const pathEmbeddedSymlinks = ".symlinks"
+
+// readEmbeddedSymlinks returns the symlinks to create, or nil if the embedded FS has none
+func (app *App) readEmbeddedSymlinks() (map[string]string, error) {
+	content, err := fs.ReadFile(app.embeddedFS(), pathEmbeddedSymlinks)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errs.WithE(err, "Failed to read embedded symlinks")
+	}
+	symlinks := map[string]string{}
+	if err := json.Unmarshal(content, &symlinks); err != nil {
+		return nil, errs.WithE(err, "Failed to parse embedded symlinks")
+	}
+	return symlinks, nil
+}
+
+// createSymlinks creates the symlinks of the extraction, refusing those pointing outside of its target
+func (e *extraction) createSymlinks() error {
+	links := make([]string, 0, len(e.symlinks))
+	for link := range e.symlinks {
+		links = append(links, link)
+	}
+	sort.Strings(links)
+
+	var created []string
+	for _, link := range links {
+		target := e.symlinks[link]
+		entry := embeddedEntry{path: link}
+		if e.excludedLocale(entry) || e.skippedConditional(link) || e.skippedIgnored(entry) {
+			continue
+		}
+		rel, ok := e.channelPath(link)
+		if !ok {
+			continue
+		}
+		fields := data.WithField("link", link).WithField("target", target)
+		if rel == "." || !filepath.IsLocal(filepath.FromSlash(rel)) {
+			return errs.WithF(fields, "Embedded symlink must be a relative path within the extraction")
+		}
+		linkPath := filepath.Join(e.target, filepath.FromSlash(rel))
+		resolved := filepath.Join(filepath.Dir(linkPath), filepath.FromSlash(target))
+		if inside, err := filepath.Rel(e.target, resolved); target == "" || filepath.IsAbs(target) || err != nil || !filepath.IsLocal(inside) {
+			return errs.WithF(fields, "Embedded symlink target escapes the extraction")
+		}
+
+		if err := os.MkdirAll(filepath.Dir(linkPath), 0755); err != nil {
+			return errs.WithEF(err, fields, "Failed to create embedded symlink directory")
+		}
+		if err := os.Remove(linkPath); err != nil && !os.IsNotExist(err) {
+			return errs.WithEF(err, fields.WithField("path", linkPath), "Failed to remove previous embedded symlink")
+		}
+		if err := os.Symlink(filepath.FromSlash(target), linkPath); err != nil {
+			return errs.WithEF(err, fields.WithField("path", linkPath), "Failed to create embedded symlink")
+		}
+		created = append(created, linkPath)
+	}
+
+	// a target can go through other embedded symlinks, only known to stay inside once they all exist
+	for _, linkPath := range created {
+		if !symlinkResolvesInside(e.target, linkPath) {
+			for _, linkPath := range created {
+				_ = os.Remove(linkPath)
+			}
+			return errs.WithF(data.WithField("path", linkPath), "Embedded symlink target escapes the extraction through another symlink")
+		}
+	}
+	return nil
+}
+
+// maxSymlinkHops bounds the symlinks followed resolving a target, a loop never resolving nor leaving root
+const maxSymlinkHops = 40
+
+// symlinkResolvesInside follows linkPath one component at a time, through the symlinks it meets,
+// and tells whether every step stays under root
+func symlinkResolvesInside(root string, linkPath string) bool {
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return false
+	}
+	current, err := filepath.EvalSymlinks(filepath.Dir(linkPath))
+	if err != nil {
+		return false
+	}
+	pending := []string{filepath.Base(linkPath)}
+	for hops := 0; len(pending) > 0; {
+		component := pending[0]
+		pending = pending[1:]
+		switch component {
+		case "", ".":
+			continue
+		case "..":
+			current = filepath.Dir(current)
+		default:
+			next := filepath.Join(current, component)
+			if info, err := os.Lstat(next); err == nil && info.Mode()&fs.ModeSymlink != 0 {
+				if hops++; hops > maxSymlinkHops {
+					return true
+				}
+				target, err := os.Readlink(next)
+				if err != nil || filepath.IsAbs(target) {
+					return false
+				}
+				pending = append(strings.Split(filepath.ToSlash(target), "/"), pending...)
+				continue
+			}
+			current = next
+		}
+		if inside, err := filepath.Rel(realRoot, current); err != nil || (inside != "." && !filepath.IsLocal(inside)) {
+			return false
+		}
+	}
+	return true
+}
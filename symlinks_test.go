@@ -0,0 +1,55 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateSymlinks(t *testing.T) {
+	target := t.TempDir()
+	writeTestFile(t, filepath.Join(target, "lib", "tool-1.2"), "tool\n")
+	e := &extraction{target: target, symlinks: map[string]string{
+		"bin/tool": "../lib/tool-1.2",
+		"current":  "lib",
+	}}
+	assert.NoError(t, e.createSymlinks())
+	assert.NoError(t, e.createSymlinks())
+
+	content, err := os.ReadFile(filepath.Join(target, "bin", "tool"))
+	assert.NoError(t, err)
+	assert.Equal(t, "tool\n", string(content))
+	link, err := os.Readlink(filepath.Join(target, "current"))
+	assert.NoError(t, err)
+	assert.Equal(t, "lib", link)
+
+	for link, escaping := range map[string]string{"bin/passwd": "../../etc/passwd", "abs": "/etc/passwd", "../outside": "lib"} {
+		e := &extraction{target: target, symlinks: map[string]string{link: escaping}}
+		assert.Error(t, e.createSymlinks(), link)
+	}
+	assert.NoFileExists(t, filepath.Join(target, "bin", "passwd"))
+}
+
+func TestCreateSymlinksThroughOtherSymlinks(t *testing.T) {
+	// lexically inside, e resolves through d/b to the parent of the extraction
+	target := t.TempDir()
+	e := &extraction{target: target, symlinks: map[string]string{"d/b": "..", "e": "d/b/.."}}
+	assert.Error(t, e.createSymlinks())
+	_, err := os.Lstat(filepath.Join(target, "e"))
+	assert.True(t, os.IsNotExist(err))
+
+	// created before the link it goes through
+	target = t.TempDir()
+	e = &extraction{target: target, symlinks: map[string]string{"s/z": "..", "a": "s/z/../.."}}
+	assert.Error(t, e.createSymlinks())
+
+	target = t.TempDir()
+	writeTestFile(t, filepath.Join(target, "lib", "tool"), "tool\n")
+	e = &extraction{target: target, symlinks: map[string]string{"d/up": "..", "tool": "d/up/lib/tool", "loop": "loop"}}
+	assert.NoError(t, e.createSymlinks())
+	content, err := os.ReadFile(filepath.Join(target, "tool"))
+	assert.NoError(t, err)
+	assert.Equal(t, "tool\n", string(content))
+}
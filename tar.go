@@ -0,0 +1,85 @@
+package app
+
+import (
+	"archive/tar"
+	"io"
+
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+)
+
+// TarEmbedded writes the embedded FS, as it would be extracted, as a tar stream to w.
+// Channel, locales, conditions, ignore rules and modes apply, routes and symlinks do not
+func (app *App) TarEmbedded(w io.Writer) error {
+	if app.Embedded == nil {
+		return errs.With("No embedded to archive")
+	}
+	if err := app.checkEmbeddedRoots(); err != nil {
+		return err
+	}
+	e, err := app.newExtraction(nil, "")
+	if err != nil {
+		return err
+	}
+	entries, err := app.embeddedEntries()
+	if err != nil {
+		return errs.WithE(err, "Failed to list embedded")
+	}
+	if e.modes, err = app.readEmbeddedManifest(); err != nil {
+		return err
+	}
+
+	tw := tar.NewWriter(w)
+	for _, entry := range entries {
+		if controlFile(entry.path) || e.excludedLocale(entry) || e.skippedConditional(entry.path) || e.skippedIgnored(entry) {
+			continue
+		}
+		name, ok := e.channelPath(entry.path)
+		if !ok || name == "." {
+			continue
+		}
+		if !entry.dir && !entry.regular {
+			return errs.WithF(data.WithField("path", entry.path), "Embedded is invalid, not a regular file")
+		}
+		if err := app.tarEntry(tw, e, entry, name); err != nil {
+			return errs.WithEF(err, data.WithField("path", entry.path), "Failed to archive embedded")
+		}
+	}
+	return tw.Close()
+}
+
+func (app *App) tarEntry(tw *tar.Writer, e *extraction, entry embeddedEntry, name string) error {
+	f, err := app.embeddedFS().Open(entry.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	if entry.dir {
+		header.Name += "/"
+		header.Mode = 0755
+	} else {
+		mode := e.fileMode(entry.path, info.Mode())
+		if e.readOnly {
+			mode &^= 0222
+		}
+		header.Mode = int64(mode)
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	if entry.dir {
+		return nil
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
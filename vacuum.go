@@ -0,0 +1,108 @@
+package app
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+)
+
+// Vacuum removes every embedded version but the ones in use, temp and backup files,
+// and markers of extractions that no longer exist, reporting the reclaimed space.
+// It takes the home lock like Init
+func (app *App) Vacuum() (int64, error) {
+	state := &initState{ctx: context.Background()}
+	if err := app.acquireLocks(state); err != nil {
+		return 0, err
+	}
+	defer state.release(app.logger())
+
+	var toRemove, removedVersions []string
+	embeddedRoots := []string{filepath.Join(app.cacheHome(), pathEmbedded)}
+	if root, ok := app.trustedRAMRoot(); ok {
+		embeddedRoots = append(embeddedRoots, root)
+	}
+	for _, root := range embeddedRoots {
+		if _, err := os.Stat(root); err != nil {
+			continue
+		}
+		embeddedVersions, err := embeddedVersionsIn(root)
+		if err != nil {
+			return 0, err
+		}
+		app.sortEmbeddedVersions(embeddedVersions)
+		for _, embeddedVersion := range app.unprotectedEmbedded(root, (KeepCurrentAndNewest{Count: 0}).ToRemove(embeddedVersions, app.Version)) {
+			toRemove = append(toRemove, filepath.Join(root, embeddedVersion), app.pidsPath(embeddedVersion))
+			removedVersions = append(removedVersions, embeddedVersion)
+		}
+	}
+	if prepared, err := os.ReadFile(filepath.Join(app.dataHome(), pathPrepared)); err == nil && slices.Contains(removedVersions, string(prepared)) {
+		toRemove = append(toRemove, filepath.Join(app.dataHome(), pathPrepared))
+	}
+
+	// nobody is extracting while we hold the lock
+	toRemove = append(toRemove, filepath.Join(app.cacheHome(), pathJournal))
+	if _, err := os.Stat(filepath.Join(app.cacheHome(), pathEmbedded, app.Version)); os.IsNotExist(err) {
+		toRemove = append(toRemove, filepath.Join(app.cacheHome(), pathManifest))
+	}
+
+	dirs := append([]string{app.Home}, embeddedRoots...)
+	if app.cacheHome() != app.Home {
+		dirs = append(dirs, app.cacheHome())
+	}
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if isTempName(entry.Name()) {
+				toRemove = append(toRemove, filepath.Join(dir, entry.Name()))
+			}
+		}
+	}
+
+	var freed int64
+	for _, path := range toRemove {
+		size, err := diskUsage(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err := removeTree(path); err != nil {
+			return freed, errs.WithEF(err, data.WithField("path", path), "Failed to vacuum")
+		}
+		app.logger().Debug(nil, data.WithField("path", path).WithField("size", size), "Vacuumed")
+		freed += size
+	}
+	return freed, nil
+}
+
+func isTempName(name string) bool {
+	return strings.HasSuffix(name, ".tmp") ||
+		strings.HasSuffix(name, ".bak") ||
+		strings.HasSuffix(name, "~") ||
+		strings.Contains(name, ".tmp-")
+}
+
+func diskUsage(path string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
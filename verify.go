@@ -0,0 +1,49 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+)
+
+// PathExtractedManifest is the Manifest of the extracted files written at the root of EmbeddedPath,
+// keyed by embedded path
+const PathExtractedManifest = ".manifest"
+
+// VerifyEmbedded hashes every extracted file again and compares it with the manifest written on extraction
+func (app *App) VerifyEmbedded() error {
+	manifest, err := ReadManifest(filepath.Join(app.EmbeddedPath, PathExtractedManifest))
+	if err != nil {
+		return err
+	}
+	locations := &extraction{target: app.EmbeddedPath, home: app.Home, routes: app.ExtractRoutes, channel: app.EmbeddedChannel}
+
+	var mismatches []string
+	for embeddedPath, entry := range manifest {
+		path, ok := locations.filePath(embeddedPath)
+		if !ok {
+			mismatches = append(mismatches, embeddedPath)
+			continue
+		}
+		sum, size, err := hashFile(path)
+		if err != nil || sum != entry.Sha256 || size != entry.Size {
+			mismatches = append(mismatches, embeddedPath)
+		}
+	}
+	if len(mismatches) > 0 {
+		sort.Strings(mismatches)
+		return errs.WithF(data.WithField("path", app.EmbeddedPath).WithField("files", mismatches), "Extracted embedded files are missing or modified")
+	}
+	return nil
+}
+
+// verifyExtractedManifest runs VerifyEmbedded when the extraction wrote a manifest, older extractions have none
+func (app *App) verifyExtractedManifest() error {
+	if _, err := os.Stat(filepath.Join(app.EmbeddedPath, PathExtractedManifest)); os.IsNotExist(err) {
+		return nil
+	}
+	return app.VerifyEmbedded()
+}
@@ -0,0 +1,27 @@
+package version
+
+// Parser validates and orders version strings, allowing version schemes other than semver
+type Parser interface {
+	Validate(v string) error
+	Compare(a, b string) (int, error)
+}
+
+// SemverParser is the default Parser, based on Parse
+type SemverParser struct{}
+
+func (SemverParser) Validate(v string) error {
+	_, err := Parse(v)
+	return err
+}
+
+func (SemverParser) Compare(a, b string) (int, error) {
+	va, err := Parse(a)
+	if err != nil {
+		return 0, err
+	}
+	vb, err := Parse(b)
+	if err != nil {
+		return 0, err
+	}
+	return va.Compare(vb), nil
+}
@@ -0,0 +1,26 @@
+package version
+
+import (
+	"github.com/blang/semver/v4"
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+)
+
+// SatisfiesRange reports whether v is in a semver range like ">=1.2.0 <2.0.0".
+// As in blang/semver, a pre-release is ordered before its release, so ">=1.2.0" excludes 1.2.0-rc.1
+func SatisfiesRange(v string, rangeExpr string) (bool, error) {
+	parsed, err := Parse(v)
+	if err != nil {
+		return false, errs.WithEF(err, data.WithField("version", v), "Failed to parse version")
+	}
+	return parsed.Satisfies(rangeExpr)
+}
+
+// Satisfies reports whether the version is in a semver range, see SatisfiesRange
+func (v SemVersion) Satisfies(rangeExpr string) (bool, error) {
+	versionRange, err := semver.ParseRange(rangeExpr)
+	if err != nil {
+		return false, errs.WithEF(err, data.WithField("range", rangeExpr), "Failed to parse version range")
+	}
+	return versionRange(v.Version), nil
+}
@@ -2,7 +2,6 @@ package version
 
 import (
 	"fmt"
-	"reflect"
 	"strconv"
 	"strings"
 	"time"
@@ -12,6 +11,9 @@ import (
 	"github.com/n0rad/go-erlog/errs"
 )
 
+// Now is the clock used by time dependent functions, replaceable to freeze time in tests
+var Now = time.Now
+
 type Version struct {
 	Version    string
 	Generation int64
@@ -21,19 +23,21 @@ type SemVersion struct {
 	semver.Version
 }
 
+// Parse parses a semver, ignoring surrounding whitespace and a leading v of release tags
 func Parse(v string) (SemVersion, error) {
-	parse, err := semver.Parse(v)
+	parse, err := semver.Parse(strings.TrimPrefix(strings.TrimSpace(v), "v"))
 	return SemVersion{Version: parse}, err
 }
 
+// ParseTolerant parses a semver like Parse, also accepting missing minor or patch numbers and leading zeros
+func ParseTolerant(v string) (SemVersion, error) {
+	parse, err := semver.ParseTolerant(v)
+	return SemVersion{Version: parse}, err
+}
+
+// Compare orders versions per semver: a pre-release is before its release and build metadata is ignored,
+// so versions differing only by their build are equal
 func (v SemVersion) Compare(o SemVersion) int {
-	if v.Minor == o.Minor &&
-		v.Major == o.Major &&
-		v.Patch == o.Patch &&
-		reflect.DeepEqual(v.Build, o.Build) &&
-		reflect.DeepEqual(v.Pre, o.Pre) {
-		return 0
-	}
 	return v.Version.Compare(o.Version)
 }
 
@@ -59,7 +63,7 @@ func GenerateDateCommitVersion(repoPath string, major int) (string, error) {
 	if err != nil {
 		return "", errs.WithE(err, "Failed to generate version")
 	}
-	return generateDateCommitVersion(major, hash, time.Now()), nil
+	return generateDateCommitVersion(major, hash, Now()), nil
 }
 
 func generateDateCommitVersion(major int, hash string, now time.Time) string {
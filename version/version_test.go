@@ -11,3 +11,65 @@ func TestGenerateDateCommitVersion(t *testing.T) {
 	assert.Equal(t, generateDateCommitVersion(42, "68cdd17", time.Date(2006, 1, 2, 0, 0, 0, 0, time.UTC)), "42.060102.0-H68cdd17")
 	assert.Equal(t, generateDateCommitVersion(42, "68cdd17", time.Date(2006, 1, 2, 3, 4, 5, 6, time.UTC)), "42.060102.304-H68cdd17")
 }
+
+func TestParseTrimsWhitespace(t *testing.T) {
+	v, err := Parse(" 1.2.3\n")
+	assert.NoError(t, err)
+	assert.Equal(t, "1.2.3", v.String())
+}
+
+func TestParseVPrefix(t *testing.T) {
+	v, err := Parse("v1.4.2")
+	assert.NoError(t, err)
+	assert.Equal(t, "1.4.2", v.String())
+
+	compare, err := SemverParser{}.Compare("v1.4.2", "1.4.2")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, compare)
+
+	_, err = Parse("v1.4")
+	assert.Error(t, err)
+	v, err = ParseTolerant("v1.4")
+	assert.NoError(t, err)
+	assert.Equal(t, "1.4.0", v.String())
+}
+
+func TestSatisfiesRange(t *testing.T) {
+	for v, expected := range map[string]bool{
+		"1.2.0":       true,
+		"v1.9.9":      true,
+		"1.1.9":       false,
+		"2.0.0":       false,
+		"1.2.0-rc.1":  false,
+		"1.3.0-beta":  true,
+		"2.0.0-rc.1":  true,
+		"1.2.0+build": true,
+	} {
+		satisfies, err := SatisfiesRange(v, ">=1.2.0 <2.0.0")
+		assert.NoError(t, err)
+		assert.Equal(t, expected, satisfies, v)
+	}
+
+	_, err := SatisfiesRange("1.2.0", "~>1.2")
+	assert.Error(t, err)
+	_, err = SatisfiesRange("1.2", ">=1.0.0")
+	assert.Error(t, err)
+}
+
+func TestSemVersionCompare(t *testing.T) {
+	compare := func(a, b string) int {
+		va, err := Parse(a)
+		assert.NoError(t, err)
+		vb, err := Parse(b)
+		assert.NoError(t, err)
+		return va.Compare(vb)
+	}
+
+	assert.Equal(t, 0, compare("1.2.3", "1.2.3"))
+	assert.Equal(t, 0, compare("1.2.3+build.1", "1.2.3+build.2"))
+	assert.Equal(t, 0, compare("1.2.3+build.1", "1.2.3"))
+	assert.Equal(t, -1, compare("1.2.3-rc.1", "1.2.3"))
+	assert.Equal(t, -1, compare("1.2.3-alpha", "1.2.3-beta"))
+	assert.Equal(t, 1, compare("1.2.3-rc.10", "1.2.3-rc.2"))
+	assert.Equal(t, -1, compare("1.2.3-rc.1+build.2", "1.2.3-rc.2+build.1"))
+}
@@ -0,0 +1,84 @@
+package app
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/n0rad/go-app/version"
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+)
+
+// VersionFileCodec formats the version recorded in Home
+type VersionFileCodec interface {
+	Encode(version string) ([]byte, error)
+	Decode(content []byte) (string, error)
+}
+
+// PlainVersionCodec records the bare version string, the default
+type PlainVersionCodec struct{}
+
+func (PlainVersionCodec) Encode(version string) ([]byte, error) {
+	return []byte(version), nil
+}
+
+func (PlainVersionCodec) Decode(content []byte) (string, error) {
+	return strings.TrimSpace(string(content)), nil
+}
+
+// JSONVersionCodec records the version with the time it was written
+type JSONVersionCodec struct{}
+
+type jsonVersionFile struct {
+	Version   string    `json:"version"`
+	WrittenAt time.Time `json:"writtenAt"`
+}
+
+func (JSONVersionCodec) Encode(appVersion string) ([]byte, error) {
+	return json.Marshal(jsonVersionFile{Version: appVersion, WrittenAt: version.Now().UTC()})
+}
+
+func (JSONVersionCodec) Decode(content []byte) (string, error) {
+	var file jsonVersionFile
+	if err := json.Unmarshal(content, &file); err != nil {
+		return "", errs.WithE(err, "Failed to parse json version file")
+	}
+	return file.Version, nil
+}
+
+func (app *App) versionFileCodec() VersionFileCodec {
+	if app.VersionFileCodec != nil {
+		return app.VersionFileCodec
+	}
+	return PlainVersionCodec{}
+}
+
+func (app *App) readHomeVersion() (string, error) {
+	content, err := os.ReadFile(filepath.Join(app.dataHome(), pathVersion))
+	if err != nil {
+		return "", err
+	}
+	homeVersion, err := app.versionFileCodec().Decode(content)
+	if err == nil {
+		return homeVersion, nil
+	}
+
+	// version files written before a codec was set are plain strings
+	legacy := strings.TrimSpace(string(content))
+	if app.versionParser().Validate(legacy) == nil {
+		app.logger().Debug(err, data.WithField("version", legacy), "Home version file is a legacy plain version")
+		return legacy, nil
+	}
+	return "", errs.WithEF(err, data.WithField("path", filepath.Join(app.dataHome(), pathVersion)), "Failed to decode home version")
+}
+
+func (app *App) writeHomeVersion() error {
+	content, err := app.versionFileCodec().Encode(app.Version)
+	if err != nil {
+		return errs.WithE(err, "Failed to encode home version")
+	}
+	return os.WriteFile(filepath.Join(app.dataHome(), pathVersion), content, 0644)
+}
@@ -0,0 +1,9 @@
+//go:build !linux && !darwin
+
+package app
+
+import "errors"
+
+func setXattr(path string, name string, value string) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,9 @@
+//go:build linux || darwin
+
+package app
+
+import "golang.org/x/sys/unix"
+
+func setXattr(path string, name string, value string) error {
+	return unix.Setxattr(path, name, []byte(value), 0)
+}
@@ -0,0 +1,74 @@
+//go:build linux || darwin
+
+package app
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/n0rad/go-app/version"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+func TestWriteProvenanceXattr(t *testing.T) {
+	probe := filepath.Join(t.TempDir(), "probe")
+	assert.NoError(t, os.WriteFile(probe, nil, 0644))
+	if err := setXattr(probe, xattrVersion, "probe"); errors.Is(err, unix.ENOTSUP) || errors.Is(err, unix.EOPNOTSUPP) {
+		t.Skip("no extended attributes support on temp dir")
+	}
+
+	app := newTestApp()
+	app.WriteProvenanceXattr = true
+	app.ReadOnlyExtract = true
+	assert.NoError(t, app.Init(t.TempDir(), &struct{}{}))
+
+	path := filepath.Join(app.EmbeddedPath, "testdata/embedded/a.txt")
+	value := make([]byte, 64)
+	size, err := unix.Getxattr(path, xattrVersion, value)
+	assert.NoError(t, err)
+	assert.Equal(t, "1.0.0", string(value[:size]))
+	size, err = unix.Getxattr(path, xattrExtractedAt, value)
+	assert.NoError(t, err)
+	assert.NotZero(t, size)
+
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0444), info.Mode().Perm())
+}
+
+func TestProvenanceXattrOfIncrementalExtract(t *testing.T) {
+	probe := filepath.Join(t.TempDir(), "probe")
+	assert.NoError(t, os.WriteFile(probe, nil, 0644))
+	if err := setXattr(probe, xattrVersion, "probe"); errors.Is(err, unix.ENOTSUP) || errors.Is(err, unix.EOPNOTSUPP) {
+		t.Skip("no extended attributes support on temp dir")
+	}
+	previousNow := version.Now
+	t.Cleanup(func() { version.Now = previousNow })
+	version.Now = func() time.Time { return time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC) }
+
+	home := t.TempDir()
+	app := newTestApp()
+	app.WriteProvenanceXattr = true
+	app.IncrementalExtract = true
+	assert.NoError(t, app.Init(home, &struct{}{}))
+
+	next := newTestApp()
+	next.Version = "1.1.0"
+	next.WriteProvenanceXattr = true
+	next.IncrementalExtract = true
+	assert.NoError(t, next.Init(home, &struct{}{}))
+
+	// hard linked from the previous tree, the file keeps the attributes of the version that wrote it
+	path := filepath.Join(next.EmbeddedPath, "testdata/embedded/a.txt")
+	value := make([]byte, 64)
+	size, err := unix.Getxattr(path, xattrVersion, value)
+	assert.NoError(t, err)
+	assert.Equal(t, "1.0.0", string(value[:size]))
+	size, err = unix.Getxattr(path, xattrExtractedAt, value)
+	assert.NoError(t, err)
+	assert.Equal(t, "2024-03-01T12:00:00Z", string(value[:size]))
+}